@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend"
+	"github.com/seqeralabs/staticreg/pkg/registry/catalog"
+	"github.com/seqeralabs/staticreg/pkg/registry/filter"
+	"github.com/spf13/cobra"
+)
+
+var previewFiltersCmd = &cobra.Command{
+	Use:   "preview-filters",
+	Short: "Lists the repositories of each registry grouped by the filter rule that matches them, without crawling anything",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		log := logger.FromContext(ctx)
+		out := cmd.OutOrStdout()
+
+		regCfgs, err := rootCfg.Registries()
+		if err != nil {
+			log.Error("error loading registries configuration", logger.ErrAttr(err))
+			return
+		}
+
+		for i := range regCfgs {
+			regCfg := &regCfgs[i]
+			regLog := log.With(slog.String("registry", regCfg.Name))
+
+			f, err := filter.New(regCfg.Filters)
+			if err != nil {
+				regLog.Error("error parsing filters", logger.ErrAttr(err))
+				return
+			}
+			upstream, err := backend.New(regCfg)
+			if err != nil {
+				regLog.Error("error creating registry client", logger.ErrAttr(err))
+				return
+			}
+			source, err := catalog.New(catalog.Config{
+				Spec:     regCfg.CatalogSource,
+				APIURL:   regCfg.CatalogAPIURL,
+				User:     regCfg.User,
+				Password: regCfg.Password,
+				PageSize: regCfg.CatalogPageSize,
+			}, backend.Chain(upstream, backend.Retry(2)))
+			if err != nil {
+				regLog.Error("error creating catalog source", logger.ErrAttr(err))
+				return
+			}
+
+			// the last group holds the repositories no rule matches
+			rules := f.Rules()
+			matches := make([][]string, len(rules)+1)
+			err = source.Walk(ctx, "", func(repos []string, cursor string) error {
+				for _, r := range repos {
+					i := f.Match(r)
+					if i < 0 {
+						i = len(rules)
+					}
+					matches[i] = append(matches[i], r)
+				}
+				return nil
+			})
+			if err != nil {
+				regLog.Error("error listing repositories", logger.ErrAttr(err))
+				return
+			}
+
+			fmt.Fprintf(out, "%s\n", regCfg.Name)
+			for i, repos := range matches {
+				name := "no matching rule (include)"
+				if i < len(rules) {
+					name = rules[i].String()
+				}
+				fmt.Fprintf(out, "  %s: %d repositories\n", name, len(repos))
+				for _, r := range repos {
+					fmt.Fprintf(out, "    %s\n", r)
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(previewFiltersCmd)
+}
@@ -41,8 +41,12 @@ var rootCmd = &cobra.Command{
 		log.Info(
 			"staticreg running with options",
 			slog.String("registry", rootCfg.RegistryHostname),
+			slog.String("registries-config", rootCfg.RegistriesFile),
+			slog.String("source", rootCfg.Source),
 			slog.Bool("skip-tls-verify", rootCfg.SkipTLSVerify),
 			slog.Bool("tls-enable", rootCfg.TLSEnabled),
+			slog.Any("tls-ca", rootCfg.TLSCAPaths),
+			slog.String("tls-cert", rootCfg.TLSClientCert),
 			slog.String("user", rootCfg.RegistryUser),
 			slog.String("password", func() string {
 				if len(rootCfg.RegistryPassword) > 0 {
@@ -50,6 +54,11 @@ var rootCmd = &cobra.Command{
 				}
 				return "[not provided]"
 			}()),
+			slog.Bool("use-docker-config", rootCfg.UseDockerConfig),
+			slog.String("catalog-source", rootCfg.CatalogSource),
+			slog.Float64("requests-per-second", rootCfg.RequestsPerSecond),
+			slog.Any("filters", rootCfg.Filters),
+			slog.Any("tag-policy", rootCfg.TagPolicy),
 		)
 	},
 }
@@ -70,8 +79,19 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&rootCfg.RegistryHostname, "registry", defaultRegistry, "registry hostname, can be set via the env var REGISTRY_HOSTNAME as well")
 	rootCmd.PersistentFlags().StringVar(&rootCfg.RegistryUser, "user", os.Getenv("REGISTRY_USER"), "registry user to use for authentication against the provided registry, can be set via the env var REGISTRY_USER as well")
 	rootCmd.PersistentFlags().StringVar(&rootCfg.RegistryPassword, "password", os.Getenv("REGISTRY_PASSWORD"), "registry password to use for authentication against the provided registry, can be set via the env var REGISTRY_PASSWORD as well")
+	rootCmd.PersistentFlags().BoolVar(&rootCfg.UseDockerConfig, "use-docker-config", false, "read registry credentials from the docker config file (~/.docker/config.json or $DOCKER_CONFIG), including credential helpers. Credentials passed via --user and --password take precedence")
 	rootCmd.PersistentFlags().BoolVar(&rootCfg.SkipTLSVerify, "skip-tls-verify", false, "disable TLS certificate checks")
-	rootCmd.PersistentFlags().BoolVar(&rootCfg.TLSEnabled, "tls-enable", false, "enable TLS")
+	rootCmd.PersistentFlags().BoolVar(&rootCfg.TLSEnabled, "tls-enable", false, "enable TLS, when disabled the registry is contacted over plain HTTP")
+	rootCmd.PersistentFlags().StringArrayVar(&rootCfg.TLSCAPaths, "tls-ca", []string{}, "PEM file or directory of PEM files with additional CAs to trust for the registry, can be repeated. Files are reloaded when they change")
+	rootCmd.PersistentFlags().StringVar(&rootCfg.TLSClientCert, "tls-cert", "", "PEM client certificate for mutual TLS against the registry, requires --tls-key. Reloaded when it changes")
+	rootCmd.PersistentFlags().StringVar(&rootCfg.TLSClientKey, "tls-key", "", "PEM client key for mutual TLS against the registry, requires --tls-cert. Reloaded when it changes")
+	rootCmd.PersistentFlags().StringVar(&rootCfg.CatalogSource, "catalog-source", "catalog", "where to list repositories from: 'catalog' for the registry /v2/_catalog endpoint, 'file:<path>' for a file with one repository per line, 'glob:<pattern>,...' for repositories matching patterns, 'dockerhub:<namespace>,...' for the Docker Hub API or 'github:[orgs/|users/]<owner>,...' for the GitHub packages API")
+	rootCmd.PersistentFlags().StringVar(&rootCfg.CatalogAPIURL, "catalog-api-url", "", "base URL of the API used by the dockerhub and github catalog sources, defaults to the public endpoints")
+	rootCmd.PersistentFlags().StringVar(&rootCfg.Source, "source", "", "read images from disk instead of the registry: 'oci-layout:<path>' for an OCI image layout or a directory of layouts, 'tarball:<path>' for a docker save tarball or a directory of them. The registry flags are ignored then")
+	rootCmd.PersistentFlags().Float64Var(&rootCfg.RequestsPerSecond, "requests-per-second", 0, "maximum number of requests per second sent to the registry, 0 for no limit. 429 Too Many Requests responses are always honored")
+	rootCmd.PersistentFlags().StringArrayVar(&rootCfg.Filters, "filter", []string{}, "rule deciding which repositories are crawled and listed, can be repeated. Rules are '<include|hide|exclude>:<pattern>' where the pattern is a glob or 're:<regexp>', the first matching rule decides: 'hide' crawls repositories without listing them, 'exclude' does not crawl them at all. Repositories no rule matches are included")
+	rootCmd.PersistentFlags().StringArrayVar(&rootCfg.TagPolicy, "tag-policy", []string{}, "rule selecting the tags whose metadata is synchronized, can be repeated. Other tags are only listed by name. Rules are 'semver', 'match:<pattern>', 'channels:<tag>,...', 'newest:<n>[:<pattern>]' and 'exclude:<pattern>', a tag is selected when any rule but exclude selects it and no exclude rule matches it. Every tag is selected by default")
+	rootCmd.PersistentFlags().StringVar(&rootCfg.RegistriesFile, "registries-config", os.Getenv("REGISTRIES_CONFIG"), "YAML file defining multiple registries to serve, each with its own credentials, TLS and refresh settings. When set, the single registry flags are ignored. Can be set via the env var REGISTRIES_CONFIG as well")
 	rootCmd.PersistentFlags().BoolVar(&rootCfg.LogInJSON, "json-logging", false, "log in JSON")
 	rootCmd.PersistentFlags().BoolVar(&rootCfg.Verbose, "verbose", false, "enable verbose logging")
 }
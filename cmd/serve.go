@@ -15,17 +15,25 @@
 package cmd
 
 import (
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"syscall"
 	"time"
 
 	"log/slog"
 
+	"github.com/chenyahui/gin-cache/persist"
+	"github.com/seqeralabs/staticreg/pkg/cfg"
 	"github.com/seqeralabs/staticreg/pkg/filler"
+	"github.com/seqeralabs/staticreg/pkg/notifier"
 	"github.com/seqeralabs/staticreg/pkg/observability/logger"
 	"github.com/seqeralabs/staticreg/pkg/registry/async"
-	"github.com/seqeralabs/staticreg/pkg/registry/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend"
+	"github.com/seqeralabs/staticreg/pkg/registry/catalog"
+	"github.com/seqeralabs/staticreg/pkg/registry/filter"
 	"github.com/seqeralabs/staticreg/pkg/server"
 	"github.com/seqeralabs/staticreg/pkg/server/staticreg"
 	"github.com/spf13/cobra"
@@ -37,8 +45,26 @@ var (
 	ignoredUserAgents []string
 	cacheDuration     time.Duration
 	refreshInterval   time.Duration
+	catalogPageSize   int
+	tagWorkers        int
+	imageInfoWorkers  int
+	webhookSecret     string
+	backendCacheTTL   time.Duration
+	faultRate         float64
+	faultLatency      time.Duration
+	stateDir          string
+	fetchTimeout      time.Duration
+	readyThreshold    time.Duration
+	notificationsFile string
+	retryAttempts     int
 )
 
+// webhookRequestTimeout bounds every request made to outgoing webhooks
+const webhookRequestTimeout = 10 * time.Second
+
+// unsafeFileChars are replaced in registry names to build their state file name
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
 var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Serves a webserver with an HTML listing of all images and tags in a v2 registry",
@@ -53,29 +79,178 @@ var serveCmd = &cobra.Command{
 			slog.String("bind-addr", bindAddr),
 			slog.Any("ignored-user-agents", ignoredUserAgents),
 			slog.Any("refresh-interval", refreshInterval),
+			slog.Int("catalog-page-size", catalogPageSize),
+			slog.Int("tag-workers", tagWorkers),
+			slog.Int("image-info-workers", imageInfoWorkers),
+			slog.Bool("registry-webhook", webhookSecret != ""),
+			slog.Int("retry-attempts", retryAttempts),
+			slog.Duration("backend-cache-ttl", backendCacheTTL),
+			slog.String("state-dir", stateDir),
+			slog.Duration("fetch-timeout", fetchTimeout),
+			slog.Duration("ready-threshold", readyThreshold),
+			slog.String("notifications-config", notificationsFile),
 		)
 
-		client := registry.New(rootCfg)
-		asyncClient := async.New(client, refreshInterval)
+		regCfgs, err := rootCfg.Registries()
+		if err != nil {
+			slog.Error("error loading registries configuration", logger.ErrAttr(err))
+			return
+		}
+
+		var notif *notifier.Notifier
+		if notificationsFile != "" {
+			notifCfg, err := cfg.LoadNotifications(notificationsFile)
+			if err != nil {
+				slog.Error("error loading notifications configuration", logger.ErrAttr(err))
+				return
+			}
+			deliveryLogFile := ""
+			if stateDir != "" {
+				deliveryLogFile = filepath.Join(stateDir, "webhook-deliveries.json")
+			}
+			notif, err = notifier.New(notifCfg, &http.Client{Timeout: webhookRequestTimeout}, deliveryLogFile)
+			if err != nil {
+				slog.Error("error creating notifier", logger.ErrAttr(err))
+				return
+			}
+		}
+
+		g, ctx := errgroup.WithContext(ctx)
+
+		registries := make([]*staticreg.Registry, 0, len(regCfgs))
+		sources := make([]notifier.Source, 0, len(regCfgs))
+		for i := range regCfgs {
+			regCfg := &regCfgs[i]
+			regLog := log.With(slog.String("registry", regCfg.Name))
+
+			repoFilter, err := filter.New(regCfg.Filters)
+			if err != nil {
+				regLog.Error("error parsing filters", logger.ErrAttr(err))
+				return
+			}
+			tagPolicy, err := filter.NewTagPolicy(regCfg.TagPolicy)
+			if err != nil {
+				regLog.Error("error parsing tag policy", logger.ErrAttr(err))
+				return
+			}
+			upstream, err := backend.New(regCfg)
+			if err != nil {
+				regLog.Error("error creating registry client", logger.ErrAttr(err))
+				return
+			}
+			// failed operations are not retried here, the crawler retries the repositories
+			// and tags that failed with its own backoff (--retry-attempts)
+			client := backend.Chain(upstream,
+				backend.Cache(backendCacheTTL),
+				backend.Logging(),
+				backend.Metrics(regCfg.Name),
+				backend.FaultInjection(faultRate, faultLatency),
+			)
+
+			regRefreshInterval := refreshInterval
+			if regCfg.RefreshInterval > 0 {
+				regRefreshInterval = regCfg.RefreshInterval
+			}
+			regCatalogPageSize := catalogPageSize
+			if regCfg.CatalogPageSize > 0 {
+				regCatalogPageSize = regCfg.CatalogPageSize
+			}
+			regTagWorkers := tagWorkers
+			if regCfg.TagWorkers > 0 {
+				regTagWorkers = regCfg.TagWorkers
+			}
+			regImageInfoWorkers := imageInfoWorkers
+			if regCfg.ImageInfoWorkers > 0 {
+				regImageInfoWorkers = regCfg.ImageInfoWorkers
+			}
+			source, err := catalog.New(catalog.Config{
+				Spec:     regCfg.CatalogSource,
+				APIURL:   regCfg.CatalogAPIURL,
+				User:     regCfg.User,
+				Password: regCfg.Password,
+				PageSize: regCatalogPageSize,
+			}, client)
+			if err != nil {
+				regLog.Error("error creating catalog source", logger.ErrAttr(err))
+				return
+			}
+
+			stateFile := ""
+			if stateDir != "" {
+				stateFile = filepath.Join(stateDir, unsafeFileChars.ReplaceAllString(regCfg.Name, "_")+".json.gz")
+			}
+			asyncClient := async.New(client, source, async.Config{
+				RefreshInterval:  regRefreshInterval,
+				TagWorkers:       regTagWorkers,
+				ImageInfoWorkers: regImageInfoWorkers,
+				StateFile:        stateFile,
+				Filter:           repoFilter,
+				TagPolicy:        tagPolicy,
+				RetryAttempts:    retryAttempts,
+			})
 
-		filler := filler.New(asyncClient, rootCfg.RegistryHostname, "/")
+			// with a single registry pages are served from the root as they always were,
+			// otherwise each registry gets its own namespace
+			absoluteDir := "/"
+			if len(regCfgs) > 1 {
+				absoluteDir = "/r/" + regCfg.Name + "/"
+			}
+			filler := filler.New(asyncClient, regCfg.Hostname, "/", absoluteDir)
 
-		regServer := staticreg.New(asyncClient, filler, rootCfg.RegistryHostname)
-		srv, err := server.New(bindAddr, regServer, log, cacheDuration, ignoredUserAgents)
+			registries = append(registries, &staticreg.Registry{
+				Name:       regCfg.Name,
+				Hostname:   regCfg.Hostname,
+				RegClient:  asyncClient,
+				DataFiller: filler,
+				Crawler:    asyncClient,
+			})
+			sources = append(sources, notifier.Source{
+				Registry:    regCfg.Name,
+				Hostname:    regCfg.Hostname,
+				AbsoluteDir: absoluteDir,
+				Subscriber:  asyncClient,
+			})
+
+			regLog.Info("serving registry",
+				slog.String("hostname", regCfg.Hostname),
+				slog.String("catalog-source", regCfg.CatalogSource),
+				slog.String("source", regCfg.Source),
+				slog.String("path", absoluteDir),
+				slog.Duration("refresh-interval", regRefreshInterval),
+				slog.Int("catalog-page-size", regCatalogPageSize),
+				slog.Int("tag-workers", regTagWorkers),
+				slog.Int("image-info-workers", regImageInfoWorkers),
+				slog.Float64("requests-per-second", regCfg.RequestsPerSecond),
+				slog.String("state-file", stateFile),
+				slog.Any("filters", regCfg.Filters),
+				slog.Any("tag-policy", regCfg.TagPolicy),
+			)
+
+			regCtx := logger.Context(ctx, regLog)
+			g.Go(func() error {
+				return asyncClient.Start(regCtx)
+			})
+		}
+
+		store := persist.NewMemoryStore(cacheDuration)
+		regServer := staticreg.New(registries, "/", store, fetchTimeout, readyThreshold)
+		srv, err := server.New(bindAddr, regServer, log, store, cacheDuration, ignoredUserAgents, webhookSecret)
 		if err != nil {
 			slog.Error("error creating server", logger.ErrAttr(err))
 			return
 		}
 
-		g, ctx := errgroup.WithContext(ctx)
-
 		g.Go(func() error {
 			return srv.Start(ctx)
 		})
-
 		g.Go(func() error {
-			return asyncClient.Start(ctx)
+			return regServer.InvalidateOnChanges(ctx)
 		})
+		if notif != nil {
+			g.Go(func() error {
+				return notif.Run(ctx, sources)
+			})
+		}
 
 		if err := g.Wait(); err != nil {
 			if ctx.Err() != nil {
@@ -93,5 +268,19 @@ func init() {
 	serveCmd.PersistentFlags().StringArrayVar(&ignoredUserAgents, "ignored-user-agent", []string{}, "user agents to ignore (reply with empty body and 200 OK). A user agent is ignored if it contains the one of the values passed to this flag")
 	serveCmd.PersistentFlags().DurationVar(&cacheDuration, "cache-duration", time.Minute*1, "how long to keep a generated page in cache before expiring it, 0 to never expire")
 	serveCmd.PersistentFlags().DurationVar(&refreshInterval, "refresh-interval", time.Minute*15, "how long to wait before trying to get fresh data from the target registry")
+	serveCmd.PersistentFlags().IntVar(&catalogPageSize, "catalog-page-size", 100, "how many repositories to request from the registry catalog in a single page")
+	serveCmd.PersistentFlags().IntVar(&tagWorkers, "tag-workers", 1, "how many repositories to list tags for concurrently")
+	serveCmd.PersistentFlags().IntVar(&imageInfoWorkers, "image-info-workers", 1, "how many tags to retrieve image information for concurrently")
+	serveCmd.PersistentFlags().StringVar(&webhookSecret, "webhook-secret", os.Getenv("WEBHOOK_SECRET"), "shared secret registries must send in the Authorization header of their notifications to /hooks/registry, the endpoint is disabled when empty. Can be set via the env var WEBHOOK_SECRET as well")
+	serveCmd.PersistentFlags().IntVar(&retryAttempts, "retry-attempts", 5, "how many times to retry, with a growing delay, a repository or tag that failed to synchronize before giving up on it until the next synchronization. Errors that retrying cannot fix are never retried")
+	serveCmd.PersistentFlags().DurationVar(&backendCacheTTL, "backend-cache-ttl", 0, "how long to reuse the result of a registry operation, 0 to disable. Tag changes are only noticed once the cached result expires")
+	serveCmd.PersistentFlags().Float64Var(&faultRate, "fault-rate", 0, "rate (0 to 1) of registry operations to fail on purpose, for testing")
+	serveCmd.PersistentFlags().DurationVar(&faultLatency, "fault-latency", 0, "maximum random delay to add to registry operations, for testing")
+	serveCmd.PersistentFlags().StringVar(&stateDir, "state-dir", os.Getenv("STATE_DIR"), "directory where what is known about each registry is saved after every synchronization and loaded at startup, so that a restart serves the registry right away. Persistence is disabled when empty. Can be set via the env var STATE_DIR as well")
+	serveCmd.PersistentFlags().DurationVar(&fetchTimeout, "fetch-timeout", 5*time.Second, "how long to wait for a repository that is not synchronized yet to be fetched when its page is requested, before showing that it is being indexed. 0 disables on-demand fetches")
+	serveCmd.PersistentFlags().StringVar(&notificationsFile, "notifications-config", os.Getenv("NOTIFICATIONS_CONFIG"), "YAML file defining webhooks to call when repositories and tags are created, moved or deleted. Can be set via the env var NOTIFICATIONS_CONFIG as well")
+	serveCmd.PersistentFlags().DurationVar(&readyThreshold, "ready-threshold", 5*time.Minute, "how long a registry can fail to synchronize before /readyz reports staticreg as not ready")
+	_ = serveCmd.PersistentFlags().MarkHidden("fault-rate")
+	_ = serveCmd.PersistentFlags().MarkHidden("fault-latency")
 	rootCmd.AddCommand(serveCmd)
 }
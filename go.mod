@@ -11,6 +11,10 @@ require (
 	github.com/puzpuzpuz/xsync/v3 v3.4.0
 	github.com/samber/slog-gin v1.13.3
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/mod v0.20.0
+	golang.org/x/sync v0.2.0
+	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -59,9 +63,7 @@ require (
 	golang.org/x/arch v0.8.0 // indirect
 	golang.org/x/crypto v0.23.0 // indirect
 	golang.org/x/net v0.25.0 // indirect
-	golang.org/x/sync v0.2.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
 	google.golang.org/protobuf v1.34.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrNoWebhooks           = errors.New("no webhooks defined")
+	ErrMissingWebhookURL    = errors.New("missing webhook url")
+	ErrDuplicateWebhookName = errors.New("duplicate webhook name")
+)
+
+// Notifications configures the webhooks called when the crawler notices changes
+type Notifications struct {
+	// SiteURL is the public URL staticreg is served from, used to link to repository pages
+	SiteURL  string    `yaml:"siteURL"`
+	Webhooks []Webhook `yaml:"webhooks"`
+}
+
+type Webhook struct {
+	// Name identifies the webhook in logs and in the delivery log, it defaults to webhook-<index>
+	// since URLs often embed a secret
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Format is json (default), slack or teams. Template overrides it with a text/template
+	// rendering the body, see notifier.Payload for what it is given.
+	Format      string `yaml:"format"`
+	Template    string `yaml:"template"`
+	ContentType string `yaml:"contentType"`
+	// Secret signs the body with HMAC-SHA256, the signature is sent in the X-Staticreg-Signature header
+	Secret  string            `yaml:"secret"`
+	Headers map[string]string `yaml:"headers"`
+	// Registries, Repositories and Events restrict what is notified, by registry name, by repository
+	// pattern (see filter.ParsePattern) and by event kind. Empty lists do not restrict anything, but
+	// Events defaults to the tag events.
+	Registries   []string `yaml:"registries"`
+	Repositories []string `yaml:"repositories"`
+	Events       []string `yaml:"events"`
+	// MaxAttempts is how many times a delivery is attempted before giving up on it
+	MaxAttempts int `yaml:"maxAttempts"`
+}
+
+func LoadNotifications(path string) (*Notifications, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Notifications
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if len(f.Webhooks) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoWebhooks, path)
+	}
+
+	seen := map[string]struct{}{}
+	for i := range f.Webhooks {
+		w := &f.Webhooks[i]
+		w.URL = os.ExpandEnv(w.URL)
+		w.Secret = os.ExpandEnv(w.Secret)
+		for k, v := range w.Headers {
+			w.Headers[k] = os.ExpandEnv(v)
+		}
+		if w.URL == "" {
+			return nil, fmt.Errorf("%w for webhook %d in %s", ErrMissingWebhookURL, i, path)
+		}
+		if w.Name == "" {
+			w.Name = fmt.Sprintf("webhook-%d", i)
+		}
+		if _, ok := seen[w.Name]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateWebhookName, w.Name)
+		}
+		seen[w.Name] = struct{}{}
+	}
+
+	return &f, nil
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrNoRegistries          = errors.New("no registries defined")
+	ErrInvalidRegistryName   = errors.New("invalid registry name")
+	ErrDuplicateRegistryName = errors.New("duplicate registry name")
+	ErrMissingHostname       = errors.New("missing registry hostname")
+	// ErrMissingSourceName is returned for a registry reading from disk without a name,
+	// paths do not make valid names
+	ErrMissingSourceName = errors.New("missing registry name, it is required with source")
+)
+
+// registryNameRegexp restricts registry names to what can be safely used as a URL path segment
+var registryNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:-]*$`)
+
+// Registry is the configuration of a single registry served by staticreg
+type Registry struct {
+	// Name identifies the registry in URLs, e.g. /r/<name>/
+	Name            string   `yaml:"name"`
+	Hostname        string   `yaml:"hostname"`
+	User            string   `yaml:"user"`
+	Password        string   `yaml:"password"`
+	UseDockerConfig bool     `yaml:"useDockerConfig"`
+	SkipTLSVerify   bool     `yaml:"skipTLSVerify"`
+	TLSEnabled      bool     `yaml:"tlsEnable"`
+	TLSCAPaths      []string `yaml:"tlsCA"`
+	TLSClientCert   string   `yaml:"tlsCert"`
+	TLSClientKey    string   `yaml:"tlsKey"`
+	// CatalogSource tells where the list of repositories comes from, see catalog.Config for the syntax
+	CatalogSource string `yaml:"catalogSource"`
+	// CatalogAPIURL overrides the base URL of the vendor API used by CatalogSource
+	CatalogAPIURL string `yaml:"catalogAPIURL"`
+	// Source reads images from disk instead of the registry, e.g. oci-layout:<path> or tarball:<path>,
+	// Hostname is not required then
+	Source string `yaml:"source"`
+	// RequestsPerSecond limits the rate of requests sent to the registry, zero means unlimited
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+	// RefreshInterval, CatalogPageSize and the worker counts fall back to the serve flags when unset
+	RefreshInterval  time.Duration `yaml:"refreshInterval"`
+	CatalogPageSize  int           `yaml:"catalogPageSize"`
+	TagWorkers       int           `yaml:"tagWorkers"`
+	ImageInfoWorkers int           `yaml:"imageInfoWorkers"`
+	// Filters decide which repositories are crawled and listed, see filter.ParseRule for their syntax
+	Filters []string `yaml:"filters"`
+	// TagPolicy selects the tags whose metadata is synchronized, see filter.NewTagPolicy for its syntax
+	TagPolicy []string `yaml:"tagPolicy"`
+}
+
+type registriesFile struct {
+	Registries []Registry `yaml:"registries"`
+}
+
+// LoadRegistries reads a list of registry definitions from a YAML file.
+// Environment variables in the form ${VAR} are expanded in user and password
+// so that credentials can be kept out of the file.
+func LoadRegistries(path string) ([]Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f registriesFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if len(f.Registries) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoRegistries, path)
+	}
+
+	seen := map[string]struct{}{}
+	for i := range f.Registries {
+		r := &f.Registries[i]
+		if r.Hostname == "" && r.Source == "" {
+			return nil, fmt.Errorf("%w for registry %d in %s", ErrMissingHostname, i, path)
+		}
+		if r.Hostname == "" {
+			if r.Name == "" {
+				return nil, fmt.Errorf("%w for registry %d in %s reading from %q", ErrMissingSourceName, i, path, r.Source)
+			}
+			r.Hostname = r.Source
+		}
+		if r.Name == "" {
+			r.Name = r.Hostname
+		}
+		if !registryNameRegexp.MatchString(r.Name) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRegistryName, r.Name)
+		}
+		if _, ok := seen[r.Name]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateRegistryName, r.Name)
+		}
+		seen[r.Name] = struct{}{}
+
+		r.User = os.ExpandEnv(r.User)
+		r.Password = os.ExpandEnv(r.Password)
+	}
+
+	return f.Registries, nil
+}
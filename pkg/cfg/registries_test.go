@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cfg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadRegistries(t *testing.T, yaml string) ([]Registry, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "registries.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadRegistries(path)
+}
+
+func TestLoadRegistries(t *testing.T) {
+	t.Setenv("REGISTRY_PASSWORD", "s3cret")
+	regs, err := loadRegistries(t, `
+registries:
+  - hostname: registry.example.com:5000
+    user: ci
+    password: ${REGISTRY_PASSWORD}
+  - name: shipped
+    source: oci-layout:/data/images
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regs[0].Name != "registry.example.com:5000" || regs[0].Password != "s3cret" {
+		t.Errorf("unexpected registry %+v", regs[0])
+	}
+	if regs[1].Name != "shipped" || regs[1].Hostname != "oci-layout:/data/images" {
+		t.Errorf("unexpected offline registry %+v", regs[1])
+	}
+}
+
+func TestLoadRegistriesErrors(t *testing.T) {
+	tests := map[string]struct {
+		yaml string
+		err  error
+	}{
+		"empty":             {yaml: "registries: []", err: ErrNoRegistries},
+		"no hostname":       {yaml: "registries:\n  - name: prod", err: ErrMissingHostname},
+		"source no name":    {yaml: "registries:\n  - source: oci-layout:/data/images", err: ErrMissingSourceName},
+		"invalid name":      {yaml: "registries:\n  - name: a/b\n    hostname: cr.example.com", err: ErrInvalidRegistryName},
+		"duplicate name":    {yaml: "registries:\n  - hostname: cr.example.com\n  - hostname: cr.example.com", err: ErrDuplicateRegistryName},
+		"duplicate offline": {yaml: "registries:\n  - name: a\n    source: tarball:/a.tar\n  - name: a\n    source: tarball:/b.tar", err: ErrDuplicateRegistryName},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadRegistries(t, tt.yaml); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
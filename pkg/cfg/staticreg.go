@@ -18,8 +18,55 @@ type Root struct {
 	RegistryHostname string
 	RegistryUser     string
 	RegistryPassword string
+	UseDockerConfig  bool
 	SkipTLSVerify    bool
 	TLSEnabled       bool
-	LogInJSON        bool
-	Verbose          bool
+	TLSCAPaths       []string
+	TLSClientCert    string
+	TLSClientKey     string
+	CatalogSource    string
+	CatalogAPIURL    string
+	// Source is where images are read from when not from the registry, e.g. oci-layout:<path> or tarball:<path>
+	Source string
+	// RequestsPerSecond limits the rate of requests sent to the registry, zero means unlimited
+	RequestsPerSecond float64
+	// Filters decide which repositories are crawled and listed
+	Filters []string
+	// TagPolicy selects the tags whose metadata is synchronized
+	TagPolicy      []string
+	RegistriesFile string
+	LogInJSON      bool
+	Verbose        bool
+}
+
+// Registries returns the registries to serve, either loaded from RegistriesFile
+// or the single registry defined by the root flags
+func (r *Root) Registries() ([]Registry, error) {
+	if r.RegistriesFile != "" {
+		return LoadRegistries(r.RegistriesFile)
+	}
+	hostname := r.RegistryHostname
+	if r.Source != "" {
+		// there is no registry to name the site after, the source is more telling
+		hostname = r.Source
+	}
+	return []Registry{{
+		Name:            hostname,
+		Hostname:        hostname,
+		User:            r.RegistryUser,
+		Password:        r.RegistryPassword,
+		UseDockerConfig: r.UseDockerConfig,
+		SkipTLSVerify:   r.SkipTLSVerify,
+		TLSEnabled:      r.TLSEnabled,
+		TLSCAPaths:      r.TLSCAPaths,
+		TLSClientCert:   r.TLSClientCert,
+		TLSClientKey:    r.TLSClientKey,
+		CatalogSource:   r.CatalogSource,
+		CatalogAPIURL:   r.CatalogAPIURL,
+		Source:          r.Source,
+
+		RequestsPerSecond: r.RequestsPerSecond,
+		Filters:           r.Filters,
+		TagPolicy:         r.TagPolicy,
+	}}, nil
 }
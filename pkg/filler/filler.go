@@ -17,8 +17,10 @@ package filler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/seqeralabs/staticreg/pkg/observability/logger"
@@ -29,43 +31,109 @@ import (
 
 type Filler struct {
 	registryHostname string
+	rootDir          string
 	absoluteDir      string
 	regClient        registry.Client
 }
 
-func New(regClient registry.Client, registryHostname string, absoluteDir string) *Filler {
+func New(regClient registry.Client, registryHostname string, rootDir string, absoluteDir string) *Filler {
 	return &Filler{
+		rootDir:          rootDir,
 		absoluteDir:      absoluteDir,
 		regClient:        regClient,
 		registryHostname: registryHostname,
 	}
 }
 
+// client returns a consistent view of the registry when the client can provide one
+func (f *Filler) client() registry.Client {
+	if s, ok := f.regClient.(registry.Snapshotter); ok {
+		return s.Snapshot()
+	}
+	return f.regClient
+}
+
 func (f *Filler) TagData(ctx context.Context, repo string, tag string) (*templates.TagData, error) {
-	imageInfo, reference, err := f.regClient.ImageInfo(ctx, repo, tag)
+	return f.tagData(ctx, f.client(), repo, tag)
+}
+
+func (f *Filler) tagData(ctx context.Context, client registry.Client, repo string, tag string) (*templates.TagData, error) {
+	imageInfo, err := client.ImageInfo(ctx, repo, tag)
+	if errors.Is(err, errs.ErrUntracked) {
+		return &templates.TagData{
+			Name:      repo,
+			Tag:       tag,
+			Untracked: true,
+		}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	cfg, err := imageInfo.ConfigFile()
+	platforms := make([]templates.PlatformData, 0, len(imageInfo.Platforms))
+	var config *templates.PlatformData
+	for i, p := range imageInfo.Platforms {
+		platforms = append(platforms, templates.PlatformData{
+			Platform:     p.Platform,
+			Digest:       p.Digest,
+			ShortDigest:  shortDigest(p.Digest),
+			MediaType:    p.MediaType,
+			Size:         humanSize(p.Size),
+			Layers:       p.Layers,
+			CreatedAt:    p.CreatedAt.Format(time.RFC3339),
+			Entrypoint:   strings.Join(p.Entrypoint, " "),
+			Cmd:          strings.Join(p.Cmd, " "),
+			ExposedPorts: p.ExposedPorts,
+			Labels:       keyValues(p.Labels),
+			Annotations:  keyValues(p.Annotations),
+		})
+		if config == nil || p.Platform == "linux/amd64" {
+			config = &platforms[i]
+		}
+	}
+	if imageInfo.Artifact != nil {
+		config = nil
+	}
+
+	referrers, err := client.Referrers(ctx, repo, tag)
 	if err != nil {
-		return nil, err
+		logger.FromContext(ctx).Warn("could not get referrers", logger.ErrAttr(err), slog.String("repo", repo), slog.String("tag", tag))
 	}
 
 	return &templates.TagData{
 		Name:          repo,
 		Tag:           tag,
-		PullReference: reference,
-		CreatedAt:     cfg.Created.Format(time.RFC3339),
+		PullReference: imageInfo.Reference,
+		PullCommand:   imageInfo.PullCommand,
+		CreatedAt:     imageInfo.CreatedAt().Format(time.RFC3339),
+		Index:         imageInfo.Index,
+		Platforms:     platforms,
+		Config:        config,
+		Referrers:     referrerGroups(referrers),
+		Artifact:      artifactData(imageInfo.Artifact),
 	}, nil
 }
 
 func (f *Filler) BaseData() templates.BaseData {
 	return templates.BaseData{
+		RootDir:      f.rootDir,
 		AbsoluteDir:  f.absoluteDir,
 		RegistryName: f.registryHostname,
-		LastUpdated:  time.Now().Format(time.RFC3339),
+		LastUpdated:  f.lastUpdated(),
+	}
+}
+
+// lastUpdated tells when the data shown was last synchronized with the registry
+func (f *Filler) lastUpdated() string {
+	s, ok := f.regClient.(registry.SyncReporter)
+	if !ok {
+		return time.Now().Format(time.RFC3339)
+	}
+	completedAt := s.LastSyncCompletedAt()
+	if completedAt.IsZero() {
+		return "never, synchronization in progress"
 	}
+	return completedAt.Format(time.RFC3339)
 }
 
 func (f *Filler) RepoData(ctx context.Context, repo string) (*templates.RepositoryData, error) {
@@ -74,7 +142,8 @@ func (f *Filler) RepoData(ctx context.Context, repo string) (*templates.Reposito
 	log := logger.FromContext(ctx).With(slog.String("repo", repo))
 	tags := []templates.TagData{}
 
-	tagList, err := f.regClient.TagList(ctx, repo)
+	client := f.client()
+	tagList, err := client.TagList(ctx, repo)
 	if err != nil {
 		if errors.Is(err, errs.ErrNotFound) {
 			return nil, nil
@@ -86,7 +155,7 @@ func (f *Filler) RepoData(ctx context.Context, repo string) (*templates.Reposito
 	}
 
 	for _, tag := range tagList {
-		tagData, err := f.TagData(ctx, repo, tag)
+		tagData, err := f.tagData(ctx, client, repo, tag)
 		if err != nil {
 			log.Warn("could not generate tag data", logger.ErrAttr(err), slog.String("tag", tag))
 			continue
@@ -109,24 +178,164 @@ func (f *Filler) RepoData(ctx context.Context, repo string) (*templates.Reposito
 		BaseData:       baseData,
 		RepositoryName: repo,
 		PullReference:  mostRecentTag.PullReference,
+		PullCommand:    mostRecentTag.PullCommand,
 		Tags:           orderedTags,
 		LastUpdatedAt:  mostRecentTag.CreatedAt,
+		Platforms:      repoPlatforms(orderedTags),
 	}
 
 	return repoData, nil
 }
 
+// orderTagsByDate puts the most recent tags first, tags with no known creation date go last
 func orderTagsByDate(tags []templates.TagData) []templates.TagData {
-	sort.Slice(tags, func(i, j int) bool {
-		dateI, err := time.Parse(time.RFC3339, tags[i].CreatedAt)
-		if err != nil {
-			return false
-		}
-		dateJ, err := time.Parse(time.RFC3339, tags[j].CreatedAt)
-		if err != nil {
-			return false
+	sort.SliceStable(tags, func(i, j int) bool {
+		dateI, errI := time.Parse(time.RFC3339, tags[i].CreatedAt)
+		dateJ, errJ := time.Parse(time.RFC3339, tags[j].CreatedAt)
+		if errI != nil || errJ != nil {
+			return errI == nil
 		}
 		return dateI.After(dateJ)
 	})
 	return tags
 }
+
+// repoPlatforms returns the sorted set of platforms available across tags
+func repoPlatforms(tags []templates.TagData) []string {
+	seen := map[string]struct{}{}
+	platforms := []string{}
+	for _, t := range tags {
+		for _, p := range t.Platforms {
+			if _, ok := seen[p.Platform]; ok || p.Platform == "" {
+				continue
+			}
+			seen[p.Platform] = struct{}{}
+			platforms = append(platforms, p.Platform)
+		}
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// artifactData converts what is known about an artifact for the templates, nil for container images
+func artifactData(artifact *registry.Artifact) *templates.ArtifactData {
+	if artifact == nil {
+		return nil
+	}
+
+	data := &templates.ArtifactData{
+		Kind:  string(artifact.Kind),
+		Type:  artifact.Type,
+		Files: make([]templates.ArtifactFileData, 0, len(artifact.Files)),
+	}
+	for _, f := range artifact.Files {
+		data.Files = append(data.Files, templates.ArtifactFileData{
+			Name:        f.Name,
+			MediaType:   f.MediaType,
+			Digest:      f.Digest,
+			ShortDigest: shortDigest(f.Digest),
+			Size:        humanSize(f.Size),
+		})
+	}
+
+	if h := artifact.Helm; h != nil {
+		data.Helm = &templates.HelmData{
+			Name:        h.Name,
+			Version:     h.Version,
+			AppVersion:  h.AppVersion,
+			Description: h.Description,
+			Home:        h.Home,
+		}
+	}
+	if s := artifact.SIF; s != nil {
+		data.SIF = &templates.SIFData{
+			Version:    s.Version,
+			Arch:       s.Arch,
+			ID:         s.ID,
+			CreatedAt:  s.CreatedAt.Format(time.RFC3339),
+			ModifiedAt: s.ModifiedAt.Format(time.RFC3339),
+		}
+	}
+	if w := artifact.WASM; w != nil {
+		data.WASM = &templates.WASMData{
+			Author: w.Author,
+		}
+		if w.OS != "" || w.Architecture != "" {
+			data.WASM.Platform = w.OS + "/" + w.Architecture
+		}
+	}
+	return data
+}
+
+// referrerGroups groups referrers by artifact type, ordered by kind and then by artifact type
+func referrerGroups(referrers []registry.Referrer) []templates.ReferrerGroup {
+	groups := []templates.ReferrerGroup{}
+	byType := map[string]int{}
+	for _, r := range referrers {
+		i, ok := byType[r.ArtifactType]
+		if !ok {
+			i = len(groups)
+			byType[r.ArtifactType] = i
+			groups = append(groups, templates.ReferrerGroup{
+				Kind:         registry.ReferrerKind(r.ArtifactType),
+				ArtifactType: r.ArtifactType,
+			})
+		}
+
+		data := templates.ReferrerData{
+			Digest:      r.Digest,
+			ShortDigest: shortDigest(r.Digest),
+			Tag:         r.Tag,
+			CreatedAt:   r.Annotations[registry.AnnotationCreated],
+		}
+		if r.Size > 0 {
+			data.Size = humanSize(r.Size)
+		}
+		groups[i].Referrers = append(groups[i].Referrers, data)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Kind != groups[j].Kind {
+			return groups[i].Kind < groups[j].Kind
+		}
+		return groups[i].ArtifactType < groups[j].ArtifactType
+	})
+	return groups
+}
+
+// keyValues returns the entries of m sorted by key
+func keyValues(m map[string]string) []templates.KeyValueData {
+	kvs := make([]templates.KeyValueData, 0, len(m))
+	for k, v := range m {
+		kvs = append(kvs, templates.KeyValueData{Key: k, Value: v})
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+	return kvs
+}
+
+// shortDigest returns the first 12 characters of the hex part of a digest, like docker does
+func shortDigest(digest string) string {
+	_, hex, ok := strings.Cut(digest, ":")
+	if !ok {
+		hex = digest
+	}
+	if len(hex) > 12 {
+		return hex[:12]
+	}
+	return hex
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry/events"
+)
+
+// maxDeliveries is how many deliveries the delivery log keeps, older ones are forgotten
+const maxDeliveries = 500
+
+// DeliveryStatus is the outcome of a delivery
+type DeliveryStatus string
+
+const (
+	Delivered DeliveryStatus = "delivered"
+	// Failed deliveries were given up on after MaxAttempts attempts or an error that retrying cannot fix
+	Failed DeliveryStatus = "failed"
+	// Dropped deliveries were never attempted because the webhook queue was full
+	Dropped DeliveryStatus = "dropped"
+)
+
+// Delivery records how a webhook was told about a change
+type Delivery struct {
+	ID         string         `json:"id"`
+	Webhook    string         `json:"webhook"`
+	Registry   string         `json:"registry"`
+	Event      events.Event   `json:"event"`
+	Status     DeliveryStatus `json:"status"`
+	Attempts   int            `json:"attempts"`
+	StatusCode int            `json:"statusCode,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	At         time.Time      `json:"at"`
+}
+
+// deliveryLog keeps the last deliveries, saving them to file after each one when file is not empty
+type deliveryLog struct {
+	mu      sync.Mutex
+	file    string
+	entries []Delivery
+}
+
+func (l *deliveryLog) add(ctx context.Context, d Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, d)
+	if len(l.entries) > maxDeliveries {
+		l.entries = slices.Clone(l.entries[len(l.entries)-maxDeliveries:])
+	}
+	if l.file == "" {
+		return
+	}
+	if err := writeDeliveries(l.file, l.entries); err != nil {
+		logger.FromContext(ctx).Error("could not save delivery log", logger.ErrAttr(err), slog.String("file", l.file))
+	}
+}
+
+func (l *deliveryLog) list() []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.entries)
+}
+
+// load reads the deliveries saved by a previous run, a missing or unreadable file starts an empty log
+func (l *deliveryLog) load(ctx context.Context) {
+	if l.file == "" {
+		return
+	}
+	log := logger.FromContext(ctx).With(slog.String("file", l.file))
+	data, err := os.ReadFile(l.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var entries []Delivery
+	if err == nil {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		log.Warn("discarding delivery log", logger.ErrAttr(err))
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(entries, l.entries...)
+	log.Debug("delivery log loaded", slog.Int("deliveries", len(entries)))
+}
+
+func writeDeliveries(path string, entries []Delivery) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(entries); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,353 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/seqeralabs/staticreg/pkg/cfg"
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry/events"
+	"github.com/seqeralabs/staticreg/pkg/registry/filter"
+)
+
+const (
+	defaultMaxAttempts = 5
+	// queueSize bounds the deliveries waiting for each webhook, changes are dropped when it is full
+	queueSize = 100
+	// subscriptionSize bounds the changes of each registry waiting to be dispatched to the webhooks
+	subscriptionSize = 1024
+	userAgent        = "seqera/staticreg"
+	contentTypeJSON  = "application/json"
+)
+
+const (
+	headerEvent     = "X-Staticreg-Event"
+	headerDelivery  = "X-Staticreg-Delivery"
+	headerSignature = "X-Staticreg-Signature"
+)
+
+var (
+	ErrInvalidFormat   = errors.New("invalid webhook format")
+	ErrInvalidTemplate = errors.New("invalid webhook template")
+	ErrInvalidEvent    = errors.New("invalid webhook event")
+	ErrInvalidPattern  = errors.New("invalid webhook repository pattern")
+	ErrDelivery        = errors.New("webhook delivery failed")
+)
+
+// defaultEvents are notified to webhooks that do not list the events they want
+var defaultEvents = []events.Kind{events.TagCreated, events.TagUpdated, events.TagDeleted}
+
+var allEvents = []events.Kind{events.RepositoryCreated, events.RepositoryDeleted, events.TagCreated, events.TagUpdated, events.TagDeleted}
+
+// Subscriber notices changes, like the crawler of a registry
+type Subscriber interface {
+	Subscribe(name string, size int) *events.Subscription
+}
+
+// Source is a registry whose changes are notified
+type Source struct {
+	Registry string
+	Hostname string
+	// AbsoluteDir is where the pages of the registry are served from, used to link to them
+	AbsoluteDir string
+	Subscriber  Subscriber
+}
+
+// Notifier calls webhooks when registries change. Each webhook has its own queue
+// and is called for one change at a time, in the order the changes were noticed.
+type Notifier struct {
+	siteURL    string
+	webhooks   []*webhook
+	client     *http.Client
+	deliveries *deliveryLog
+}
+
+type webhook struct {
+	name         string
+	url          string
+	contentType  string
+	secret       string
+	headers      map[string]string
+	registries   []string
+	repositories []filter.Pattern
+	events       []events.Kind
+	maxAttempts  int
+	render       renderer
+	queue        chan Payload
+}
+
+// New creates a notifier calling the webhooks of cfg with client. Deliveries are recorded
+// in deliveryLogFile, which is loaded when the notifier runs, unless it is empty.
+func New(cfg *cfg.Notifications, client *http.Client, deliveryLogFile string) (*Notifier, error) {
+	n := &Notifier{
+		siteURL:    strings.TrimSuffix(cfg.SiteURL, "/"),
+		client:     client,
+		deliveries: &deliveryLog{file: deliveryLogFile},
+	}
+	for _, whCfg := range cfg.Webhooks {
+		wh, err := newWebhook(whCfg)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", whCfg.Name, err)
+		}
+		n.webhooks = append(n.webhooks, wh)
+	}
+	return n, nil
+}
+
+func newWebhook(whCfg cfg.Webhook) (*webhook, error) {
+	render, err := newRenderer(whCfg.Format, whCfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	wh := &webhook{
+		name:        whCfg.Name,
+		url:         whCfg.URL,
+		contentType: whCfg.ContentType,
+		secret:      whCfg.Secret,
+		headers:     whCfg.Headers,
+		registries:  whCfg.Registries,
+		events:      defaultEvents,
+		maxAttempts: whCfg.MaxAttempts,
+		render:      render,
+		queue:       make(chan Payload, queueSize),
+	}
+	if wh.contentType == "" {
+		wh.contentType = contentTypeJSON
+	}
+	if wh.maxAttempts <= 0 {
+		wh.maxAttempts = defaultMaxAttempts
+	}
+	for _, spec := range whCfg.Repositories {
+		p, err := filter.ParsePattern(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidPattern, spec, err)
+		}
+		wh.repositories = append(wh.repositories, p)
+	}
+	if len(whCfg.Events) > 0 {
+		wh.events = nil
+		for _, e := range whCfg.Events {
+			kind := events.Kind(e)
+			if !slices.Contains(allEvents, kind) {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidEvent, e)
+			}
+			wh.events = append(wh.events, kind)
+		}
+	}
+	return wh, nil
+}
+
+// Deliveries returns the last deliveries, oldest first
+func (n *Notifier) Deliveries() []Delivery {
+	return n.deliveries.list()
+}
+
+// Run notifies the changes of sources until ctx is done
+func (n *Notifier) Run(ctx context.Context, sources []Source) error {
+	n.deliveries.load(ctx)
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, wh := range n.webhooks {
+		g.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case p := <-wh.queue:
+					n.deliver(ctx, wh, p)
+				}
+			}
+		})
+	}
+	for _, src := range sources {
+		sub := src.Subscriber.Subscribe("webhooks", subscriptionSize)
+		g.Go(func() error {
+			defer sub.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case e := <-sub.Events():
+					n.dispatch(ctx, src, e)
+				}
+			}
+		})
+	}
+	return g.Wait()
+}
+
+// dispatch queues e for the webhooks interested in it
+func (n *Notifier) dispatch(ctx context.Context, src Source, e events.Event) {
+	for _, wh := range n.webhooks {
+		if !wh.wants(src.Registry, e) {
+			continue
+		}
+		p := n.payload(wh, src, e)
+		select {
+		case wh.queue <- p:
+		default:
+			logger.FromContext(ctx).Warn("webhook queue full, dropping change", slog.String("webhook", wh.name), slog.Any("event", e))
+			n.deliveries.add(ctx, Delivery{
+				ID:       newDeliveryID(),
+				Webhook:  wh.name,
+				Registry: src.Registry,
+				Event:    e,
+				Status:   Dropped,
+				At:       time.Now(),
+			})
+		}
+	}
+}
+
+func (wh *webhook) wants(registry string, e events.Event) bool {
+	if len(wh.registries) > 0 && !slices.Contains(wh.registries, registry) {
+		return false
+	}
+	if !slices.Contains(wh.events, e.Kind) {
+		return false
+	}
+	if len(wh.repositories) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(wh.repositories, func(p filter.Pattern) bool {
+		return p.Matches(e.Repository)
+	})
+}
+
+func (n *Notifier) payload(wh *webhook, src Source, e events.Event) Payload {
+	p := Payload{
+		Webhook:  wh.name,
+		Registry: src.Registry,
+		Hostname: src.Hostname,
+		Event:    e,
+		Text:     describe(src.Registry, e),
+	}
+	if e.Tag != "" {
+		p.Reference = src.Hostname + "/" + e.Repository + ":" + e.Tag
+	}
+	if n.siteURL != "" && e.Kind != events.RepositoryDeleted {
+		p.URL = n.siteURL + src.AbsoluteDir + "repo/" + e.Repository
+	}
+	return p
+}
+
+// deliver calls wh about p, retrying with an exponential backoff, and records the outcome
+func (n *Notifier) deliver(ctx context.Context, wh *webhook, p Payload) {
+	d := Delivery{
+		ID:       newDeliveryID(),
+		Webhook:  wh.name,
+		Registry: p.Registry,
+		Event:    p.Event,
+	}
+	log := logger.FromContext(ctx).With(slog.String("webhook", wh.name), slog.String("delivery", d.ID), slog.Any("event", p.Event))
+
+	body, err := wh.render(p)
+	if err == nil {
+		err = backoff.Retry(func() error {
+			d.Attempts++
+			d.StatusCode, err = n.send(ctx, wh, d.ID, p.Kind, body)
+			if err != nil {
+				log.Debug("webhook delivery attempt failed", logger.ErrAttr(err), slog.Int("attempt", d.Attempts))
+			}
+			return err
+		}, backoff.WithContext(backoff.WithMaxRetries(newExponentialBackoff(), uint64(wh.maxAttempts-1)), ctx))
+	}
+	if ctx.Err() != nil {
+		// shutting down, the delivery is neither done nor given up on
+		return
+	}
+
+	d.At = time.Now()
+	d.Status = Delivered
+	if err != nil {
+		d.Status = Failed
+		d.Error = err.Error()
+		log.Warn("webhook delivery failed", logger.ErrAttr(err), slog.Int("attempts", d.Attempts))
+	} else {
+		log.Debug("webhook delivered", slog.Int("attempts", d.Attempts))
+	}
+	n.deliveries.add(ctx, d)
+}
+
+// send makes a single request to wh and returns the response status code. Errors that
+// retrying cannot fix, like most 4xx responses, are permanent.
+func (n *Notifier) send(ctx context.Context, wh *webhook, id string, kind events.Kind, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, backoff.Permanent(err)
+	}
+	req.Header.Set("Content-Type", wh.contentType)
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(headerEvent, string(kind))
+	req.Header.Set(headerDelivery, id)
+	if wh.secret != "" {
+		req.Header.Set(headerSignature, "sha256="+sign(wh.secret, body))
+	}
+	for k, v := range wh.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return resp.StatusCode, fmt.Errorf("%w: %s", ErrDelivery, resp.Status)
+	}
+	return resp.StatusCode, backoff.Permanent(fmt.Errorf("%w: %s", ErrDelivery, resp.Status))
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newExponentialBackoff() *backoff.ExponentialBackOff {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxInterval = time.Minute
+	bo.MaxElapsedTime = 15 * time.Minute
+	return bo
+}
@@ -0,0 +1,378 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/cfg"
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry/events"
+)
+
+// request is what the receiver got
+type request struct {
+	header  http.Header
+	body    []byte
+	payload Payload
+}
+
+// receiver is a webhook endpoint answering with the status codes of statuses in turn, 200 once they run out
+type receiver struct {
+	*httptest.Server
+	calls    atomic.Int32
+	requests chan request
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{requests: make(chan request, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		call := int(r.calls.Add(1))
+		body, _ := io.ReadAll(req.Body)
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("unexpected body %q: %v", body, err)
+		}
+		r.requests <- request{header: req.Header, body: body, payload: p}
+		if call <= len(statuses) {
+			w.WriteHeader(statuses[call-1])
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// next waits for the next request
+func (r *receiver) next(t *testing.T) request {
+	t.Helper()
+	select {
+	case req := <-r.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook request received")
+		return request{}
+	}
+}
+
+// fakeRegistry is a source of changes, subscribed tells when the notifier listens to it
+type fakeRegistry struct {
+	bus        *events.Bus
+	subscribed chan struct{}
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{bus: events.NewBus(), subscribed: make(chan struct{})}
+}
+
+func (f *fakeRegistry) Subscribe(name string, size int) *events.Subscription {
+	defer close(f.subscribed)
+	return f.bus.Subscribe(name, size)
+}
+
+func testContext() context.Context {
+	return logger.Context(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// run starts n on sources until the test ends, and waits for it to listen to them
+func run(t *testing.T, n *Notifier, sources ...Source) {
+	ctx, cancel := context.WithCancel(testContext())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = n.Run(ctx, sources)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	for _, src := range sources {
+		<-src.Subscriber.(*fakeRegistry).subscribed
+	}
+}
+
+func newNotifier(t *testing.T, deliveryLogFile string, webhooks ...cfg.Webhook) *Notifier {
+	t.Helper()
+	n, err := New(&cfg.Notifications{SiteURL: "https://staticreg.example.com/", Webhooks: webhooks}, http.DefaultClient, deliveryLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func source(name string) Source {
+	return Source{Registry: name, Hostname: name + ".example.com", AbsoluteDir: "/", Subscriber: newFakeRegistry()}
+}
+
+func publish(src Source, e events.Event) {
+	src.Subscriber.(*fakeRegistry).bus.Publish(e)
+}
+
+// waitDeliveries waits for n to record count deliveries
+func waitDeliveries(t *testing.T, n *Notifier, count int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := n.Deliveries()
+		if len(deliveries) >= count {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d deliveries, want %d", len(deliveries), count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	recv := newReceiver(t)
+	n := newNotifier(t, "", cfg.Webhook{
+		Name:    "ci",
+		URL:     recv.URL,
+		Secret:  "s3cret",
+		Headers: map[string]string{"Authorization": "Bearer abc"},
+	})
+	src := source("main")
+	run(t, n, src)
+
+	publish(src, events.Event{Kind: events.TagCreated, Repository: "team/app", Tag: "1.0", Digest: "sha256:aaaa"})
+	req := recv.next(t)
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(req.body)
+	if got, want := req.header.Get(headerSignature), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := req.header.Get(headerEvent); got != string(events.TagCreated) {
+		t.Errorf("event header = %q", got)
+	}
+	if req.header.Get(headerDelivery) == "" {
+		t.Error("no delivery id")
+	}
+	if got := req.header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("custom header = %q", got)
+	}
+	if got := req.header.Get("Content-Type"); got != contentTypeJSON {
+		t.Errorf("content type = %q", got)
+	}
+	p := req.payload
+	if p.Webhook != "ci" || p.Registry != "main" || p.Repository != "team/app" || p.Tag != "1.0" {
+		t.Errorf("unexpected payload %+v", p)
+	}
+	if p.Reference != "main.example.com/team/app:1.0" {
+		t.Errorf("reference = %q", p.Reference)
+	}
+	if p.URL != "https://staticreg.example.com/repo/team/app" {
+		t.Errorf("url = %q", p.URL)
+	}
+}
+
+func TestNoSignatureWithoutSecret(t *testing.T) {
+	recv := newReceiver(t)
+	n := newNotifier(t, "", cfg.Webhook{Name: "ci", URL: recv.URL})
+	src := source("main")
+	run(t, n, src)
+
+	publish(src, events.Event{Kind: events.TagDeleted, Repository: "team/app", Tag: "1.0"})
+	if req := recv.next(t); req.header.Get(headerSignature) != "" {
+		t.Errorf("unexpected signature %q", req.header.Get(headerSignature))
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		status     DeliveryStatus
+		attempts   int
+		statusCode int
+	}{
+		{name: "server error retried", statuses: []int{http.StatusServiceUnavailable}, status: Delivered, attempts: 2, statusCode: http.StatusOK},
+		{name: "throttling retried", statuses: []int{http.StatusTooManyRequests}, status: Delivered, attempts: 2, statusCode: http.StatusOK},
+		{name: "client error not retried", statuses: []int{http.StatusBadRequest}, status: Failed, attempts: 1, statusCode: http.StatusBadRequest},
+		{name: "gone not retried", statuses: []int{http.StatusGone}, status: Failed, attempts: 1, statusCode: http.StatusGone},
+		{
+			name:       "given up after max attempts",
+			statuses:   []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			status:     Failed,
+			attempts:   2,
+			statusCode: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			recv := newReceiver(t, tt.statuses...)
+			n := newNotifier(t, "", cfg.Webhook{Name: "ci", URL: recv.URL, MaxAttempts: 2})
+			src := source("main")
+			run(t, n, src)
+
+			publish(src, events.Event{Kind: events.TagUpdated, Repository: "team/app", Tag: "latest"})
+			d := waitDeliveries(t, n, 1)[0]
+			if d.Status != tt.status || d.Attempts != tt.attempts || d.StatusCode != tt.statusCode {
+				t.Errorf("delivery %s after %d attempts with %d, want %s after %d attempts with %d",
+					d.Status, d.Attempts, d.StatusCode, tt.status, tt.attempts, tt.statusCode)
+			}
+			if got := int(recv.calls.Load()); got != tt.attempts {
+				t.Errorf("receiver called %d times, want %d", got, tt.attempts)
+			}
+			if tt.status == Failed && d.Error == "" {
+				t.Error("failed delivery without error")
+			}
+		})
+	}
+}
+
+func TestFiltering(t *testing.T) {
+	recv := newReceiver(t)
+	n := newNotifier(t, "", cfg.Webhook{
+		Name:         "ci",
+		URL:          recv.URL,
+		Registries:   []string{"main"},
+		Repositories: []string{"team/*", "re:^infra/"},
+		Events:       []string{string(events.RepositoryCreated), string(events.TagDeleted)},
+	})
+	main, other := source("main"), source("other")
+	run(t, n, main, other)
+
+	// the sentinel is the last event of each registry the webhook wants, once it is received all
+	// the changes published before it were dispatched
+	sentinel := events.Event{Kind: events.TagDeleted, Repository: "team/last", Tag: "1.0"}
+	publish(other, events.Event{Kind: events.TagDeleted, Repository: "team/app", Tag: "1.0"})
+	publish(main, events.Event{Kind: events.TagCreated, Repository: "team/app", Tag: "1.0"})
+	publish(main, events.Event{Kind: events.TagDeleted, Repository: "team/app", Tag: "2.0"})
+	publish(main, events.Event{Kind: events.TagDeleted, Repository: "team/sub/app", Tag: "1.0"})
+	publish(main, events.Event{Kind: events.TagDeleted, Repository: "library/app", Tag: "1.0"})
+	publish(main, events.Event{Kind: events.RepositoryCreated, Repository: "infra/tools/db"})
+	publish(main, events.Event{Kind: events.RepositoryDeleted, Repository: "infra/tools/db"})
+	publish(main, sentinel)
+
+	var got []string
+	for {
+		p := recv.next(t).payload
+		got = append(got, string(p.Kind)+" "+p.Registry+" "+p.Repository)
+		if p.Repository == sentinel.Repository {
+			break
+		}
+	}
+	want := []string{
+		"tag.deleted main team/app",
+		"repository.created main infra/tools/db",
+		"tag.deleted main team/last",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %q, want %q", got, want)
+			break
+		}
+	}
+}
+
+func TestDefaultEvents(t *testing.T) {
+	recv := newReceiver(t)
+	n := newNotifier(t, "", cfg.Webhook{Name: "ci", URL: recv.URL})
+	src := source("main")
+	run(t, n, src)
+
+	publish(src, events.Event{Kind: events.RepositoryCreated, Repository: "team/app"})
+	publish(src, events.Event{Kind: events.TagCreated, Repository: "team/app", Tag: "1.0"})
+	if p := recv.next(t).payload; p.Kind != events.TagCreated {
+		t.Errorf("got %s, want only tag events by default", p.Kind)
+	}
+}
+
+func TestInvalidWebhooks(t *testing.T) {
+	tests := map[string]cfg.Webhook{
+		"event":   {Name: "ci", URL: "http://localhost", Events: []string{"tag.pushed"}},
+		"pattern": {Name: "ci", URL: "http://localhost", Repositories: []string{"re:("}},
+		"format":  {Name: "ci", URL: "http://localhost", Format: "irc"},
+	}
+	for name, wh := range tests {
+		if _, err := New(&cfg.Notifications{Webhooks: []cfg.Webhook{wh}}, http.DefaultClient, ""); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestDeliveryLog(t *testing.T) {
+	ok, broken := newReceiver(t), newReceiver(t, http.StatusNotFound)
+	file := filepath.Join(t.TempDir(), "deliveries.json")
+	webhooks := []cfg.Webhook{{Name: "ok", URL: ok.URL}, {Name: "broken", URL: broken.URL}}
+	n := newNotifier(t, file, webhooks...)
+	src := source("main")
+	run(t, n, src)
+
+	e := events.Event{Kind: events.TagCreated, Repository: "team/app", Tag: "1.0", Digest: "sha256:aaaa"}
+	publish(src, e)
+	deliveries := waitDeliveries(t, n, 2)
+
+	byWebhook := map[string]Delivery{}
+	for _, d := range deliveries {
+		byWebhook[d.Webhook] = d
+		if d.ID == "" || d.At.IsZero() || d.Registry != "main" || d.Event.Repository != e.Repository || d.Event.Tag != e.Tag {
+			t.Errorf("unexpected delivery %+v", d)
+		}
+	}
+	if d := byWebhook["ok"]; d.Status != Delivered || d.StatusCode != http.StatusOK {
+		t.Errorf("ok: %+v", d)
+	}
+	if d := byWebhook["broken"]; d.Status != Failed || d.StatusCode != http.StatusNotFound {
+		t.Errorf("broken: %+v", d)
+	}
+	if got := ok.next(t).header.Get(headerDelivery); got != byWebhook["ok"].ID {
+		t.Errorf("delivery header %q, want the id %q of the log", got, byWebhook["ok"].ID)
+	}
+
+	// a restart keeps the log
+	restarted := newNotifier(t, file, webhooks...)
+	run(t, restarted, source("main"))
+	loaded := waitDeliveries(t, restarted, 2)
+	if len(loaded) != 2 {
+		t.Fatalf("loaded %d deliveries, want 2", len(loaded))
+	}
+	for i := range loaded {
+		if loaded[i].ID != deliveries[i].ID || loaded[i].Status != deliveries[i].Status {
+			t.Errorf("loaded %+v, want %+v", loaded[i], deliveries[i])
+		}
+	}
+}
+
+func TestFullQueue(t *testing.T) {
+	n := newNotifier(t, "", cfg.Webhook{Name: "ci", URL: "http://localhost"})
+	src := source("main")
+	e := events.Event{Kind: events.TagCreated, Repository: "team/app", Tag: "1.0"}
+	// nothing drains the queue without Run
+	for range queueSize + 1 {
+		n.dispatch(testContext(), src, e)
+	}
+	deliveries := n.Deliveries()
+	if len(deliveries) != 1 || deliveries[0].Status != Dropped || deliveries[0].Attempts != 0 {
+		t.Errorf("got %+v, want a dropped delivery", deliveries)
+	}
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/seqeralabs/staticreg/pkg/registry/events"
+)
+
+// shortDigestLen is how many characters of a digest are shown in messages, algorithm included
+const shortDigestLen = 19
+
+// slackTemplate renders a Slack incoming webhook message
+const slackTemplate = `{"text": {{json .Text}}, "blocks": [` +
+	`{"type": "section", "text": {"type": "mrkdwn", "text": {{if .URL}}{{json (printf "<%s|%s>" .URL .Text)}}{{else}}{{json .Text}}{{end}}}}` +
+	`{{if .Digest}}, {"type": "context", "elements": [{"type": "mrkdwn", "text": {{json .Digest}}}]}{{end}}]}`
+
+// teamsTemplate renders a Microsoft Teams incoming webhook message card
+const teamsTemplate = `{"@type": "MessageCard", "@context": "https://schema.org/extensions", "summary": {{json .Text}}, ` +
+	`"text": {{if .URL}}{{json (printf "[%s](%s)" .Text .URL)}}{{else}}{{json .Text}}{{end}}}`
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Payload is what a webhook is told about a change, the json format sends it as is
+// and templates are executed with it
+type Payload struct {
+	Webhook  string `json:"webhook"`
+	Registry string `json:"registry"`
+	Hostname string `json:"hostname"`
+	events.Event
+	// Reference is the reference of the tag, empty for repository events
+	Reference string `json:"reference,omitempty"`
+	// URL links to the repository page, it is empty unless the site URL is configured
+	URL string `json:"url,omitempty"`
+	// Text describes the change in a sentence
+	Text string `json:"text"`
+}
+
+// renderer renders the body of a webhook request
+type renderer func(p Payload) ([]byte, error)
+
+func newRenderer(format string, tpl string) (renderer, error) {
+	switch {
+	case tpl != "":
+		return templateRenderer("custom", tpl)
+	case format == "slack":
+		return templateRenderer(format, slackTemplate)
+	case format == "teams":
+		return templateRenderer(format, teamsTemplate)
+	case format == "" || format == "json":
+		return func(p Payload) ([]byte, error) {
+			return json.Marshal(p)
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %q, expected json, slack or teams", ErrInvalidFormat, format)
+}
+
+func templateRenderer(name string, text string) (renderer, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+	return func(p Payload) ([]byte, error) {
+		var b strings.Builder
+		if err := tpl.Execute(&b, p); err != nil {
+			return nil, err
+		}
+		return []byte(b.String()), nil
+	}, nil
+}
+
+// describe summarizes a change in a sentence
+func describe(registry string, e events.Event) string {
+	ref := e.Repository + ":" + e.Tag
+	switch e.Kind {
+	case events.RepositoryCreated:
+		return fmt.Sprintf("New repository %s in %s", e.Repository, registry)
+	case events.RepositoryDeleted:
+		return fmt.Sprintf("Repository %s deleted from %s", e.Repository, registry)
+	case events.TagCreated:
+		return fmt.Sprintf("New tag %s in %s", ref, registry)
+	case events.TagUpdated:
+		return fmt.Sprintf("Tag %s moved to %s in %s", ref, shortDigest(e.Digest), registry)
+	case events.TagDeleted:
+		return fmt.Sprintf("Tag %s deleted from %s", ref, registry)
+	}
+	return fmt.Sprintf("%s %s in %s", e.Kind, e.Repository, registry)
+}
+
+func shortDigest(digest string) string {
+	if len(digest) <= shortDigestLen {
+		return digest
+	}
+	return digest[:shortDigestLen]
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"strings"
+	"time"
+)
+
+// Media types used to recognize the kind of an artifact
+const (
+	MediaTypeHelmConfig    = "application/vnd.cncf.helm.config.v1+json"
+	MediaTypeSIFConfig     = "application/vnd.sylabs.sif.config.v1+json"
+	MediaTypeSIFLayer      = "application/vnd.sylabs.sif.layer.v1.sif"
+	MediaTypeWASMConfigV0  = "application/vnd.wasm.config.v0+json"
+	MediaTypeWASMConfigV1  = "application/vnd.wasm.config.v1+json"
+	MediaTypeWASMLayer     = "application/wasm"
+	wasmArtifactTypePrefix = "application/vnd.wasm."
+)
+
+// Annotations read from artifact manifests and blobs
+const (
+	AnnotationTitle   = "org.opencontainers.image.title"
+	AnnotationCreated = "org.opencontainers.image.created"
+)
+
+// ArtifactKind tells how a non-container artifact should be presented
+type ArtifactKind string
+
+const (
+	ArtifactKindHelm    ArtifactKind = "helm"
+	ArtifactKindSIF     ArtifactKind = "sif"
+	ArtifactKindWASM    ArtifactKind = "wasm"
+	ArtifactKindGeneric ArtifactKind = "generic"
+)
+
+// Artifact describes a tag pointing to something that is not a container image
+type Artifact struct {
+	Kind ArtifactKind
+	// Type is the artifactType of the manifest, or the media type of its config when not set
+	Type string
+	// Files are the layers of the artifact, or the manifests of an index
+	Files       []ArtifactFile
+	Annotations map[string]string
+
+	// Helm, SIF and WASM are set, when available, for the corresponding kind
+	Helm *HelmChart
+	SIF  *SIFHeader
+	WASM *WASMConfig
+}
+
+// ArtifactFile is a blob of an artifact
+type ArtifactFile struct {
+	// Name is the org.opencontainers.image.title annotation, as set by oras push
+	Name      string
+	MediaType string
+	Digest    string
+	Size      int64
+}
+
+// HelmChart is the metadata of a Helm chart, as stored in its config blob
+type HelmChart struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"appVersion"`
+	Description string `json:"description"`
+	APIVersion  string `json:"apiVersion"`
+	Type        string `json:"type"`
+	Home        string `json:"home"`
+}
+
+// SIFHeader is the global header of a Singularity image file
+type SIFHeader struct {
+	Version    string
+	Arch       string
+	ID         string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+}
+
+// WASMConfig is the config blob of a WebAssembly artifact
+type WASMConfig struct {
+	Created      time.Time `json:"created"`
+	Author       string    `json:"author"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+}
+
+// ArtifactKindOf returns the kind of an artifact from its artifactType, or config media type
+func ArtifactKindOf(artifactType string, layers []ArtifactFile) ArtifactKind {
+	switch {
+	case artifactType == MediaTypeHelmConfig:
+		return ArtifactKindHelm
+	case artifactType == MediaTypeSIFConfig:
+		return ArtifactKindSIF
+	case strings.HasPrefix(artifactType, wasmArtifactTypePrefix):
+		return ArtifactKindWASM
+	}
+	// some tools push with an empty or generic config, look at the layers instead
+	for _, l := range layers {
+		switch l.MediaType {
+		case MediaTypeSIFLayer:
+			return ArtifactKindSIF
+		case MediaTypeWASMLayer:
+			return ArtifactKindWASM
+		}
+	}
+	return ArtifactKindGeneric
+}
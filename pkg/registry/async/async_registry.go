@@ -18,25 +18,47 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/puzpuzpuz/xsync/v3"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/seqeralabs/staticreg/pkg/observability/logger"
 	"github.com/seqeralabs/staticreg/pkg/registry"
-	registryimpl "github.com/seqeralabs/staticreg/pkg/registry/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend"
+	"github.com/seqeralabs/staticreg/pkg/registry/catalog"
+	"github.com/seqeralabs/staticreg/pkg/registry/events"
+	"github.com/seqeralabs/staticreg/pkg/registry/filter"
 )
 
 const imageInfoRequestsBufSize = 10
 const tagRequestBufferSize = 10
+const defaultTagWorkers = 1
+const defaultImageInfoWorkers = 1
+
+const (
+	// maxFetchDuration bounds how long an on-demand fetch is waited for once nobody waits for it anymore
+	maxFetchDuration = time.Minute
+	// fetchRate and fetchBurst limit the on-demand fetches, since anybody opening a page can ask for one
+	fetchRate  = 2
+	fetchBurst = 10
+	// missingTTL is how long a repository that an on-demand fetch did not find is not fetched again
+	missingTTL = 5 * time.Minute
+)
 
 var (
 	ErrNoTagsFound       = errors.New("no tags found")
 	ErrImageInfoNotFound = errors.New("image info not found")
+	// ErrRepositoryExcluded is returned when asked to synchronize a repository excluded by the filter
+	ErrRepositoryExcluded = errors.New("repository excluded")
+	// ErrTooManyFetches is returned when asked to fetch a repository while too many were fetched recently
+	ErrTooManyFetches = errors.New("too many on-demand fetches")
 )
 
 // Async is a struct that wraps an underlying registry.Client
@@ -44,19 +66,121 @@ var (
 // It continuously syncs data from the registry in a separate goroutine.
 type Async struct {
 	// underlying is the actual registry client that does the registry operations, remember this is just a wrapper!
-	underlying *registryimpl.Registry
+	underlying backend.Backend
+	// source lists the repositories to synchronize
+	source catalog.Source
+	// filter decides which of the repositories listed by source are crawled and listed
+	filter *filter.Filter
+	// tagPolicy selects the tags whose image info is synchronized, the others are only listed
+	tagPolicy *filter.TagPolicy
 	// refreshInterval represents the time to wait to synchronize repositories again after a successful synchronization
 	refreshInterval time.Duration
-
-	// repos is an in memory list of all the repository names in the registry
-	repos      map[string]registry.RepoData
-	reposMutex sync.RWMutex
+	// tagWorkers and imageInfoWorkers are the number of goroutines serving each stage of the synchronization
+	tagWorkers       int
+	imageInfoWorkers int
+	// repositoryRequests and imageInfoRequests feed the two stages of the synchronization,
+	// they are fed by the catalog walk and by Refresh
+	repositoryRequests chan repositoryRequest
+	imageInfoRequests  chan imageInfoRequest
+	// priorityRepositoryRequests and priorityImageInfoRequests are fed by Refresh, workers always
+	// take from them first so that what users and registries asked for skips the catalog walk
+	priorityRepositoryRequests chan repositoryRequest
+	priorityImageInfoRequests  chan imageInfoRequest
+	// fetches deduplicates the on-demand fetches of the same repository, fetchLimiter limits them
+	// and missing remembers when the repositories they did not find were looked for
+	fetches      singleflight.Group
+	fetchLimiter *rate.Limiter
+	missing      *xsync.MapOf[string, time.Time]
+	// catalogCursor is the cursor of the last catalog page that was fully enqueued,
+	// a failed synchronization resumes from here instead of walking the catalog from the start
+	catalogCursor string
+
+	// snapshot is what readers are served, it is rebuilt from the maps below and swapped atomically.
+	// publishMu makes sure snapshots are built one at a time.
+	snapshot  atomic.Pointer[Snapshot]
+	publishMu sync.Mutex
 
 	// repositoryTags represents the list of tags for each repository
 	repositoryTags *xsync.MapOf[string, []string]
 
 	// imageInfo contains the image information indexed by repo name and tag
-	imageInfo *xsync.MapOf[imageInfoKey, imageInfo]
+	imageInfo *xsync.MapOf[imageInfoKey, registry.ImageInfo]
+
+	// untrackedTags are the tags left out by the tag policy, nothing but their name is known
+	untrackedTags *xsync.MapOf[imageInfoKey, struct{}]
+
+	// referrers contains the artifacts attached to the image of each tag, indexed by repo name and tag
+	referrers *xsync.MapOf[imageInfoKey, []registry.Referrer]
+
+	// fallbackReferrers contains, for each repository, the cosign tags (sha256-<digest>.sig|att|sbom)
+	// indexed by the digest of the image they refer to
+	fallbackReferrers *xsync.MapOf[string, map[string][]registry.Referrer]
+
+	// generation is the generation of the last full synchronization that was started,
+	// repoGenerations and tagGenerations are the generations repositories and tags were last seen in
+	generation      atomic.Uint64
+	repoGenerations *xsync.MapOf[string, uint64]
+	tagGenerations  *xsync.MapOf[imageInfoKey, uint64]
+
+	// health is the outcome of the last repositories synchronization
+	health   Health
+	healthMu sync.RWMutex
+
+	// lastSync summarizes the last completed full synchronization
+	lastSync   *SyncStats
+	lastSyncMu sync.RWMutex
+	// current is the full synchronization in progress, nil between two of them
+	current atomic.Pointer[syncRun]
+
+	// repoErrors and tagErrors are the last errors met synchronizing repositories and tags,
+	// they are cleared once the repository or tag is synchronized successfully
+	repoErrors *xsync.MapOf[string, ItemError]
+	tagErrors  *xsync.MapOf[imageInfoKey, ItemError]
+
+	// retries are the repositories and tags waiting to be tried again after failing,
+	// deadLetters those that are not retried anymore until the next full synchronization.
+	// Repositories are keyed with an empty tag.
+	retries       *xsync.MapOf[imageInfoKey, Retry]
+	deadLetters   *xsync.MapOf[imageInfoKey, DeadLetter]
+	retryAttempts int
+
+	// stateFile is where what is known about the registry is saved, so that it can be served
+	// right away after a restart. Nothing is saved when it is empty.
+	stateFile string
+	stateMu   sync.Mutex
+	// stateLoaded is true once a saved state was loaded
+	stateLoaded atomic.Bool
+
+	// bus delivers the changes noticed while synchronizing to subscribers
+	bus *events.Bus
+}
+
+// Health reports the outcome of the last repositories synchronization
+type Health struct {
+	// LastSyncedAt is when the catalog was last walked successfully, zero if it never was
+	LastSyncedAt time.Time
+	// LastError is the error of the last synchronization attempt, nil if it succeeded
+	LastError error
+}
+
+// Config tunes the synchronization
+type Config struct {
+	// RefreshInterval is the time to wait to synchronize repositories again after a successful synchronization
+	RefreshInterval time.Duration
+	// TagWorkers is how many repositories have their tags listed concurrently
+	TagWorkers int
+	// ImageInfoWorkers is how many tags have their image info retrieved concurrently
+	ImageInfoWorkers int
+	// StateFile is where to save what is known about the registry after every full synchronization,
+	// it is loaded at startup. Empty disables persistence.
+	StateFile string
+	// Filter decides which repositories are crawled and listed, nil includes all of them
+	Filter *filter.Filter
+	// TagPolicy selects the tags whose image info is synchronized, nil selects all of them
+	TagPolicy *filter.TagPolicy
+	// RetryAttempts is how many times a repository or tag that failed to synchronize is retried
+	// before the next full synchronization, zero gives up on them right away
+	RetryAttempts int
 }
 
 type imageInfoKey struct {
@@ -65,47 +189,55 @@ type imageInfoKey struct {
 }
 type repositoryRequest struct {
 	repo string
+	run  *syncRun
+}
+
+func (r repositoryRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("repo", r.repo))
 }
 
 type imageInfoRequest struct {
 	repo string
 	tag  string
+	run  *syncRun
 }
 
-type imageInfo struct {
-	image     v1.Image
-	reference string
+func (r imageInfoRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("repo", r.repo), slog.String("tag", r.tag))
 }
 
+// Start synchronizes the registry until ctx is done, which is the only reason it returns
 func (c *Async) Start(ctx context.Context) error {
 	log := logger.FromContext(ctx)
-	g, ctx := errgroup.WithContext(ctx)
+	c.loadState(ctx)
+	// the state is saved once more on the way out, so that a restart does not lose what
+	// was crawled since the last full synchronization
+	defer c.saveState(context.WithoutCancel(ctx))
 
-	// repositoryRequestBuffer generates requests for the `handleRepositoryRequest`
-	// handler that is responsible for retrieving the tags for a given image and
-	// scheduling new jobs on `imageInfoRequestsBuffer`
-	repositoryRequestBuffer := make(chan repositoryRequest, tagRequestBufferSize)
-	// imageInfoRequestsBuffer is responsible for feeding `handleImageInfoRequest`
-	// so that image info is retrieved for each <repo,tag> combination
-	imageInfoRequestsBuffer := make(chan imageInfoRequest, imageInfoRequestsBufSize)
-
-	defer func() {
-		close(repositoryRequestBuffer)
-		close(imageInfoRequestsBuffer)
-	}()
+	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
 		for {
+			run := newSyncRun(c.generation.Add(1), func(run *syncRun) {
+				c.completeSync(ctx, run)
+			})
+			c.current.Store(run)
 			err := backoff.Retry(func() error {
-				err := c.synchronizeRepositories(ctx, repositoryRequestBuffer)
+				err := c.synchronizeRepositories(ctx, run, c.repositoryRequests)
 				if err != nil {
 					log.Error("err", logger.ErrAttr(err))
 				}
+				if ctx.Err() == nil {
+					c.recordSync(err)
+				}
 				return err
 			}, backoff.WithContext(newExponentialBackoff(), ctx))
-
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			if err != nil {
-				return err
+				// the error is reported through Health, the next attempt waits for the refresh interval
+				log.Error("giving up on the synchronization until the next refresh", logger.ErrAttr(err))
 			}
 
 			wait := time.After(c.refreshInterval)
@@ -120,68 +252,196 @@ func (c *Async) Start(ctx context.Context) error {
 	})
 
 	g.Go(func() error {
-		for {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case req := <-repositoryRequestBuffer:
-				c.handleRepositoryRequest(ctx, imageInfoRequestsBuffer, req)
-			}
-		}
+		return c.runRetries(ctx)
 	})
 
-	g.Go(func() error {
-		for {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case req := <-imageInfoRequestsBuffer:
+	for i := 0; i < c.tagWorkers; i++ {
+		g.Go(func() error {
+			for {
+				req, err := next(ctx, c.priorityRepositoryRequests, c.repositoryRequests)
+				if err != nil {
+					return err
+				}
+				c.handleRepositoryRequest(ctx, req)
+			}
+		})
+	}
+
+	for i := 0; i < c.imageInfoWorkers; i++ {
+		g.Go(func() error {
+			for {
+				req, err := next(ctx, c.priorityImageInfoRequests, c.imageInfoRequests)
+				if err != nil {
+					return err
+				}
 				c.handleImageInfoRequest(ctx, req)
 			}
-		}
-	})
+		})
+	}
 
 	return g.Wait()
 }
 
-func (c *Async) synchronizeRepositories(ctx context.Context, reqChan chan<- repositoryRequest) error {
+func (c *Async) synchronizeRepositories(ctx context.Context, run *syncRun, reqChan chan<- repositoryRequest) error {
 	log := logger.FromContext(ctx)
-	log.Info("starting process to synchronize repositories")
-	repos, err := c.underlying.RepoList(ctx)
-	if err != nil {
-		return err
+	if c.catalogCursor != "" {
+		log.Info("resuming process to synchronize repositories", slog.String("cursor", c.catalogCursor))
+	} else {
+		log.Info("starting process to synchronize repositories")
 	}
 
-	for _, r := range repos {
-		select {
-		case reqChan <- repositoryRequest{repo: r}:
-		case <-ctx.Done():
+	err := c.source.Walk(ctx, c.catalogCursor, func(repos []string, cursor string) error {
+		for _, r := range repos {
+			if c.filter.Action(r) == filter.Exclude {
+				run.repositoriesExcluded.Add(1)
+				continue
+			}
+			c.markRepository(run, r)
+			run.add()
+			select {
+			case reqChan <- repositoryRequest{repo: r, run: run}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		c.catalogCursor = cursor
+		log.Debug("catalog page enqueued", slog.String("cursor", cursor), slog.Int("repositories", len(repos)))
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
 			return nil
 		}
+		return err
 	}
 
+	c.catalogCursor = ""
+	log.Info("catalog walk completed, waiting for tags to be synchronized")
+	run.finishCatalog()
 	return nil
 }
 
-func (c *Async) handleRepositoryRequest(ctx context.Context, reqChan chan<- imageInfoRequest, req repositoryRequest) {
+func (c *Async) completeSync(ctx context.Context, run *syncRun) {
+	stats := run.stats()
+	stats.RepositoriesEvicted, stats.TagsEvicted = c.sweep(ctx, run)
+	c.publish()
+
+	c.lastSyncMu.Lock()
+	c.lastSync = &stats
+	c.lastSyncMu.Unlock()
+	c.current.CompareAndSwap(run, nil)
+	c.saveState(ctx)
+	c.forgetMissing()
+
+	logger.FromContext(ctx).Info("repositories synchronization completed", slog.Any("stats", stats))
+}
+
+// LastSync returns the statistics of the last completed full synchronization,
+// false if no synchronization completed yet
+func (c *Async) LastSync() (SyncStats, bool) {
+	c.lastSyncMu.RLock()
+	defer c.lastSyncMu.RUnlock()
+	if c.lastSync == nil {
+		return SyncStats{}, false
+	}
+	return *c.lastSync, true
+}
+
+// Synchronized tells if there is something worth serving, either because a full synchronization
+// completed or because a saved state was loaded
+func (c *Async) Synchronized() bool {
+	_, ok := c.LastSync()
+	return ok || c.stateLoaded.Load()
+}
+
+// next returns the next request to handle, requests on priority are always taken first
+func next[T any](ctx context.Context, priority <-chan T, normal <-chan T) (T, error) {
+	select {
+	case req := <-priority:
+		return req, nil
+	default:
+	}
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case req := <-priority:
+		return req, nil
+	case req := <-normal:
+		return req, nil
+	}
+}
+
+func (c *Async) handleRepositoryRequest(ctx context.Context, req repositoryRequest) {
+	defer req.run.done()
 	log := logger.FromContext(ctx)
 	reqLog := log.With(slog.Any("req", req))
 	reqLog.Debug("handleRepositoryRequest")
+	req.run.repositories.Add(1)
 	tags, err := c.underlying.TagList(ctx, req.repo)
-
 	if err != nil {
+		req.run.repositoriesFailed.Add(1)
 		reqLog.Warn("could not list tags for image", logger.ErrAttr(err))
+		known, ok := c.repositoryTags.Load(req.repo)
+		if !ok && req.run.priority() {
+			// most likely the on-demand fetch of a repository that does not exist, it is not fetched
+			// again for a while but nothing else is remembered
+			if backend.IsPermanent(err) {
+				c.missing.Store(req.repo, time.Now())
+			}
+			return
+		}
+		c.recordRepositoryError(req.repo, err)
+		// what we know about the repository is kept until its tags can be listed again
+		c.markTags(req.run, req.repo, known)
+		c.scheduleRetry(ctx, req.run, retryKey(req.repo, ""), err)
 		return
-
 	}
 
-	c.repositoryTags.Store(req.repo, tags)
-
+	// referrer fallback tags are not shown as tags, they are attached to the image they refer to instead
+	visibleTags := make([]string, 0, len(tags))
+	fallbackReferrers := map[string][]registry.Referrer{}
 	for _, t := range tags {
+		digest, artifactType, ok := registry.ParseReferrerTag(t)
+		if !ok {
+			visibleTags = append(visibleTags, t)
+			continue
+		}
+		if artifactType != "" {
+			fallbackReferrers[digest] = append(fallbackReferrers[digest], registry.Referrer{
+				ArtifactType: artifactType,
+				Tag:          t,
+			})
+		}
+	}
+
+	c.recordRepositoryError(req.repo, nil)
+	c.clearRetry(retryKey(req.repo, ""))
+	c.missing.Delete(req.repo)
+	c.fallbackReferrers.Store(req.repo, fallbackReferrers)
+	var prevTags []string
+	repoKnown := false
+	c.repositoryTags.Compute(req.repo, func(old []string, loaded bool) ([]string, bool) {
+		prevTags, repoKnown = old, loaded
+		return visibleTags, false
+	})
+	c.markRepository(req.run, req.repo)
+	c.markTags(req.run, req.repo, visibleTags)
+	selectedTags := c.tagPolicy.Select(visibleTags)
+	c.untrackTags(req.run, req.repo, visibleTags, selectedTags)
+	c.emitTagListChanges(req.repo, repoKnown, prevTags, visibleTags, selectedTags)
+
+	reqChan := c.imageInfoRequests
+	if req.run.priority() {
+		reqChan = c.priorityImageInfoRequests
+	}
+	for _, t := range selectedTags {
+		req.run.add()
 		select {
 		case reqChan <- imageInfoRequest{
 			repo: req.repo,
 			tag:  t,
+			run:  req.run,
 		}:
 		case <-ctx.Done():
 			return
@@ -189,84 +449,373 @@ func (c *Async) handleRepositoryRequest(ctx context.Context, reqChan chan<- imag
 	}
 }
 
+// untrackTags records which tags of repo are left out by the tag policy and forgets what was known about them
+func (c *Async) untrackTags(run *syncRun, repo string, tags []string, selected []string) {
+	isSelected := make(map[string]struct{}, len(selected))
+	for _, t := range selected {
+		isSelected[t] = struct{}{}
+	}
+	for _, t := range tags {
+		key := imageInfoKey{repo: repo, tag: t}
+		if _, ok := isSelected[t]; ok {
+			c.untrackedTags.Delete(key)
+			continue
+		}
+		run.tagsUntracked.Add(1)
+		c.untrackedTags.Store(key, struct{}{})
+		c.imageInfo.Delete(key)
+		c.referrers.Delete(key)
+		c.tagErrors.Delete(key)
+		c.clearRetry(key)
+	}
+}
+
 func (c *Async) handleImageInfoRequest(ctx context.Context, req imageInfoRequest) {
+	defer req.run.done()
 	log := logger.FromContext(ctx)
 	reqLog := log.With(slog.Any("req", req))
 	reqLog.Debug("handleImageInfoRequest")
-	key := imageInfoKey(req)
+	key := imageInfoKey{
+		repo: req.repo,
+		tag:  req.tag,
+	}
+
+	// a HEAD request is enough to know if the tag moved since the last time we fetched it
+	prev, known := c.imageInfo.Load(key)
+	if known && prev.Digest != "" {
+		digest, err := c.underlying.Digest(ctx, req.repo, req.tag)
+		if err != nil {
+			reqLog.Debug("could not get digest for tag, fetching image info", logger.ErrAttr(err))
+		} else if digest == prev.Digest {
+			req.run.tagsUnchanged.Add(1)
+			c.recordTagError(key, nil)
+			c.clearRetry(key)
+			c.updateReferrers(ctx, req, digest)
+			return
+		}
+	}
 
 	// update image info
-	i, r, err := c.underlying.ImageInfo(ctx, req.repo, req.tag)
+	info, err := c.underlying.ImageInfo(ctx, req.repo, req.tag)
+	c.recordTagError(key, err)
 	if err != nil {
+		req.run.tagsFailed.Add(1)
 		reqLog.Warn("could not get image info for tag", logger.ErrAttr(err))
+		c.scheduleRetry(ctx, req.run, key, err)
 		return
 	}
-	imageInfo := imageInfo{
-		image:     i,
-		reference: r,
+	c.clearRetry(key)
+	c.imageInfo.Store(key, info)
+	if known {
+		req.run.tagsUpdated.Add(1)
+		if prev.Digest != "" && prev.Digest != info.Digest {
+			c.emit(events.Event{Kind: events.TagUpdated, Repository: req.repo, Tag: req.tag, Digest: info.Digest, PreviousDigest: prev.Digest})
+		}
+	} else {
+		req.run.tagsNew.Add(1)
+		c.emit(events.Event{Kind: events.TagCreated, Repository: req.repo, Tag: req.tag, Digest: info.Digest})
 	}
-	c.imageInfo.Store(key, imageInfo)
+	c.updateReferrers(ctx, req, info.Digest)
+	c.maybePublish()
+}
 
-	// update repos
-	cf, err := imageInfo.image.ConfigFile()
-	if err != nil {
-		reqLog.Warn("could not get config file for tag", logger.ErrAttr(err))
+// updateReferrers retrieves the artifacts attached to the image with the given digest.
+// Referrers are refreshed even when the tag did not move, since signatures and attestations
+// are usually pushed after the image.
+func (c *Async) updateReferrers(ctx context.Context, req imageInfoRequest, digest string) {
+	if digest == "" {
 		return
 	}
+	reqLog := logger.FromContext(ctx).With(slog.Any("req", req))
+	key := imageInfoKey{
+		repo: req.repo,
+		tag:  req.tag,
+	}
 
-	if prev, ok := c.repos[req.repo]; ok {
-		if prev.LastUpdatedAt.After(cf.Created.Time) {
-			return
+	referrers, err := c.underlying.Referrers(ctx, req.repo, digest)
+	if err != nil {
+		reqLog.Warn("could not get referrers for tag", logger.ErrAttr(err))
+		// keep what we knew, the referrers API might just be temporarily unavailable
+		if prev, ok := c.referrers.Load(key); ok {
+			referrers = prev
+		}
+	}
+
+	if fallback, ok := c.fallbackReferrers.Load(req.repo); ok {
+		for _, r := range fallback[digest] {
+			d, err := c.underlying.Digest(ctx, req.repo, r.Tag)
+			if err != nil {
+				reqLog.Warn("could not get digest for referrer tag", logger.ErrAttr(err), slog.String("referrer-tag", r.Tag))
+				continue
+			}
+			r.Digest = d
+			referrers = append(referrers, r)
 		}
 	}
 
-	c.reposMutex.Lock()
-	defer c.reposMutex.Unlock()
-	c.repos[req.repo] = registry.RepoData{
-		Name:          req.repo,
-		LastUpdatedAt: cf.Created.Time,
-		PullReference: r,
+	c.referrers.Store(key, referrers)
+}
+
+func (c *Async) recordSync(err error) {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+	c.health.LastError = err
+	if err == nil {
+		c.health.LastSyncedAt = time.Now()
 	}
 }
 
+// Health returns the outcome of the last repositories synchronization
+func (c *Async) Health() Health {
+	c.healthMu.RLock()
+	defer c.healthMu.RUnlock()
+	return c.health
+}
+
+// RepoList, TagList, ImageInfo and Referrers read from the last published snapshot,
+// use Snapshot to get a consistent view across several calls
+
 func (c *Async) RepoList(ctx context.Context) (repos map[string]registry.RepoData, err error) {
-	return c.repos, nil
+	return c.snapshot.Load().RepoList(ctx)
 }
 
 func (c *Async) TagList(ctx context.Context, repo string) ([]string, error) {
-	tags, ok := c.repositoryTags.Load(repo)
-	if !ok {
-		return nil, ErrNoTagsFound
+	return c.snapshot.Load().TagList(ctx, repo)
+}
+
+func (c *Async) ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	return c.snapshot.Load().ImageInfo(ctx, repo, tag)
+}
+
+func (c *Async) Referrers(ctx context.Context, repo string, tag string) ([]registry.Referrer, error) {
+	return c.snapshot.Load().Referrers(ctx, repo, tag)
+}
+
+// Fetch synchronizes repo ahead of the catalog walk and waits until it is done, or until ctx expires.
+// Concurrent fetches of the same repository share the same work, which is waited for at most
+// maxFetchDuration when nobody waits for it anymore. New fetches are rate limited and a repository
+// that was not found is not fetched again for missingTTL.
+func (c *Async) Fetch(ctx context.Context, repo string) error {
+	if at, ok := c.missing.Load(repo); ok && time.Since(at) < missingTTL {
+		return nil
+	}
+	ch := c.fetches.DoChan(repo, func() (any, error) {
+		if !c.fetchLimiter.Allow() {
+			return nil, ErrTooManyFetches
+		}
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), maxFetchDuration)
+		defer cancel()
+		done := make(chan struct{})
+		if err := c.Refresh(fetchCtx, repo, "", func() { close(done) }); err != nil {
+			return nil, err
+		}
+		select {
+		case <-done:
+			return nil, nil
+		case <-fetchCtx.Done():
+			return nil, fetchCtx.Err()
+		}
+	})
+
+	select {
+	case res := <-ch:
+		return res.Err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return tags, nil
 }
 
-func (c *Async) ImageInfo(ctx context.Context, repo string, tag string) (image v1.Image, reference string, err error) {
-	key := imageInfoKey{
-		repo: repo,
-		tag:  tag,
+// forgetMissing forgets the repositories not found by on-demand fetches long enough ago to be fetched again
+func (c *Async) forgetMissing() {
+	c.missing.Range(func(repo string, at time.Time) bool {
+		if time.Since(at) >= missingTTL {
+			c.missing.Delete(repo)
+		}
+		return true
+	})
+}
+
+// Refresh schedules the synchronization of a single tag, or of the whole repository when tag is empty,
+// ahead of the catalog walk. onComplete, if not nil, is called once the work is done.
+func (c *Async) Refresh(ctx context.Context, repo string, tag string, onComplete func()) error {
+	if c.filter.Action(repo) == filter.Exclude {
+		return ErrRepositoryExcluded
+	}
+	run := newSyncRun(0, func(*syncRun) {
+		c.publish()
+		if onComplete != nil {
+			onComplete()
+		}
+	})
+
+	_, known := c.repositoryTags.Load(repo)
+	_, _, isReferrer := registry.ParseReferrerTag(tag)
+	run.add()
+	if tag == "" || isReferrer || !known || c.tagPolicy != nil {
+		// referrer tags are attached to other tags and a new tag can change what the tag policy
+		// selects, the whole repository needs to be looked at again
+		select {
+		case c.priorityRepositoryRequests <- repositoryRequest{repo: repo, run: run}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		c.repositoryTags.Compute(repo, func(tags []string, loaded bool) ([]string, bool) {
+			if slices.Contains(tags, tag) {
+				return tags, false
+			}
+			return append(slices.Clone(tags), tag), false
+		})
+		c.markRepository(run, repo)
+		c.markTags(run, repo, []string{tag})
+		select {
+		case c.priorityImageInfoRequests <- imageInfoRequest{repo: repo, tag: tag, run: run}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	run.finishCatalog()
+	return nil
+}
+
+// DeleteTag forgets a tag right away, without waiting for the next synchronization
+func (c *Async) DeleteTag(repo string, tag string) {
+	c.deleteTag(repo, tag)
+	c.publish()
+}
+
+func (c *Async) deleteTag(repo string, tag string) {
+	c.deleteTags(repo, func(t string) bool {
+		return t == tag
+	})
+	// the tag might already be gone from the tag list while what is known about it is still around
+	c.forgetTag(imageInfoKey{repo: repo, tag: tag})
+}
+
+// DeleteDigest forgets every tag pointing to digest and returns them
+func (c *Async) DeleteDigest(repo string, digest string) []string {
+	deleted := []string{}
+	c.deleteTags(repo, func(t string) bool {
+		info, ok := c.imageInfo.Load(imageInfoKey{repo: repo, tag: t})
+		if ok && info.Digest == digest {
+			deleted = append(deleted, t)
+			return true
+		}
+		return false
+	})
+	if len(deleted) > 0 {
+		c.publish()
+	}
+	return deleted
+}
+
+// DeleteRepository forgets a repository and all of its tags
+func (c *Async) DeleteRepository(repo string) {
+	c.deleteRepository(repo)
+	c.publish()
+}
+
+func (c *Async) deleteRepository(repo string) {
+	_, known := c.repositoryTags.Load(repo)
+	c.deleteTags(repo, func(string) bool {
+		return true
+	})
+	c.repositoryTags.Delete(repo)
+	if known {
+		c.emit(events.Event{Kind: events.RepositoryDeleted, Repository: repo})
 	}
-	info, ok := c.imageInfo.Load(key)
-	if !ok {
-		return nil, "", ErrImageInfoNotFound
+	c.fallbackReferrers.Delete(repo)
+	c.repoGenerations.Delete(repo)
+	c.repoErrors.Delete(repo)
+	c.clearRetry(retryKey(repo, ""))
+}
+
+// deleteTags removes the tags of repo matching del, along with what is known about them.
+// The change is only visible to readers once a snapshot is published.
+func (c *Async) deleteTags(repo string, del func(tag string) bool) {
+	remaining := []string{}
+	deleted := []events.Event{}
+	c.repositoryTags.Compute(repo, func(tags []string, loaded bool) ([]string, bool) {
+		if !loaded {
+			return nil, true
+		}
+		for _, t := range tags {
+			if !del(t) {
+				remaining = append(remaining, t)
+				continue
+			}
+			key := imageInfoKey{repo: repo, tag: t}
+			info, _ := c.imageInfo.Load(key)
+			deleted = append(deleted, events.Event{Kind: events.TagDeleted, Repository: repo, Tag: t, Digest: info.Digest})
+			c.forgetTag(key)
+		}
+		return remaining, false
+	})
+	for _, e := range deleted {
+		c.emit(e)
 	}
-	return info.image, info.reference, nil
 }
 
-func New(client *registryimpl.Registry, refreshInterval time.Duration) *Async {
-	return &Async{
-		underlying:      client,
-		refreshInterval: refreshInterval,
-		repositoryTags:  xsync.NewMapOf[string, []string](),
-		imageInfo:       xsync.NewMapOf[imageInfoKey, imageInfo](),
-		repos:           map[string]registry.RepoData{},
+func (c *Async) forgetTag(key imageInfoKey) {
+	c.imageInfo.Delete(key)
+	c.untrackedTags.Delete(key)
+	c.referrers.Delete(key)
+	c.tagGenerations.Delete(key)
+	c.tagErrors.Delete(key)
+	c.clearRetry(key)
+}
+
+func New(client backend.Backend, source catalog.Source, cfg Config) *Async {
+	if cfg.TagWorkers <= 0 {
+		cfg.TagWorkers = defaultTagWorkers
+	}
+	if cfg.ImageInfoWorkers <= 0 {
+		cfg.ImageInfoWorkers = defaultImageInfoWorkers
+	}
+	c := &Async{
+		underlying:        client,
+		source:            source,
+		filter:            cfg.Filter,
+		tagPolicy:         cfg.TagPolicy,
+		refreshInterval:   cfg.RefreshInterval,
+		tagWorkers:        cfg.TagWorkers,
+		imageInfoWorkers:  cfg.ImageInfoWorkers,
+		stateFile:         cfg.StateFile,
+		retryAttempts:     max(cfg.RetryAttempts, 0),
+		repositoryTags:    xsync.NewMapOf[string, []string](),
+		imageInfo:         xsync.NewMapOf[imageInfoKey, registry.ImageInfo](),
+		untrackedTags:     xsync.NewMapOf[imageInfoKey, struct{}](),
+		referrers:         xsync.NewMapOf[imageInfoKey, []registry.Referrer](),
+		repoGenerations:   xsync.NewMapOf[string, uint64](),
+		tagGenerations:    xsync.NewMapOf[imageInfoKey, uint64](),
+		repoErrors:        xsync.NewMapOf[string, ItemError](),
+		tagErrors:         xsync.NewMapOf[imageInfoKey, ItemError](),
+		fetchLimiter:      rate.NewLimiter(fetchRate, fetchBurst),
+		missing:           xsync.NewMapOf[string, time.Time](),
+		retries:           xsync.NewMapOf[imageInfoKey, Retry](),
+		deadLetters:       xsync.NewMapOf[imageInfoKey, DeadLetter](),
+		fallbackReferrers: xsync.NewMapOf[string, map[string][]registry.Referrer](),
+		bus:               events.NewBus(),
+		// repositoryRequests generates requests for the `handleRepositoryRequest`
+		// handler that is responsible for retrieving the tags for a given image and
+		// scheduling new jobs on `imageInfoRequests`
+		repositoryRequests: make(chan repositoryRequest, max(tagRequestBufferSize, cfg.TagWorkers)),
+		// imageInfoRequests is responsible for feeding `handleImageInfoRequest`
+		// so that image info is retrieved for each <repo,tag> combination
+		imageInfoRequests:          make(chan imageInfoRequest, max(imageInfoRequestsBufSize, cfg.ImageInfoWorkers)),
+		priorityRepositoryRequests: make(chan repositoryRequest, max(tagRequestBufferSize, cfg.TagWorkers)),
+		priorityImageInfoRequests:  make(chan imageInfoRequest, max(imageInfoRequestsBufSize, cfg.ImageInfoWorkers)),
 	}
+	c.snapshot.Store(emptySnapshot())
+	return c
 }
 
+// newExponentialBackoff paces the attempts to walk the catalog, it never gives up: an unreachable
+// registry is reported through Health while the other registries keep being served
 func newExponentialBackoff() *backoff.ExponentialBackOff {
 	bo := backoff.NewExponentialBackOff()
 	bo.Multiplier = 1.1
-	bo.MaxInterval = 10 * time.Second
-	bo.MaxElapsedTime = 5 * time.Minute
+	bo.MaxInterval = time.Minute
+	bo.MaxElapsedTime = 0
 	return bo
 }
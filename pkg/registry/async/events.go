@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"github.com/seqeralabs/staticreg/pkg/registry/events"
+)
+
+// Subscribe creates a subscription to the changes noticed while synchronizing the registry,
+// see events.Bus. Changes are only emitted once there is something to compare with:
+// after the first full synchronization, or right away when a saved state was loaded.
+func (c *Async) Subscribe(name string, size int) *events.Subscription {
+	return c.bus.Subscribe(name, size)
+}
+
+func (c *Async) emit(e events.Event) {
+	if !c.Synchronized() {
+		return
+	}
+	c.bus.Publish(e)
+}
+
+// emitTagListChanges emits the changes between the previous and the current tag list of repo.
+// Tags that were never described are announced once their image info is known, unless the tag
+// policy leaves them out. Tags that disappeared are announced right away, even though what is
+// known about them is only forgotten once a full synchronization completes.
+func (c *Async) emitTagListChanges(repo string, repoKnown bool, prev []string, tags []string, selected []string) {
+	if !repoKnown {
+		c.emit(events.Event{Kind: events.RepositoryCreated, Repository: repo})
+	}
+
+	previous := make(map[string]struct{}, len(prev))
+	for _, t := range prev {
+		previous[t] = struct{}{}
+	}
+	current := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		current[t] = struct{}{}
+	}
+	isSelected := make(map[string]struct{}, len(selected))
+	for _, t := range selected {
+		isSelected[t] = struct{}{}
+	}
+
+	for _, t := range prev {
+		if _, ok := current[t]; ok {
+			continue
+		}
+		info, _ := c.imageInfo.Load(imageInfoKey{repo: repo, tag: t})
+		c.emit(events.Event{Kind: events.TagDeleted, Repository: repo, Tag: t, Digest: info.Digest})
+	}
+	for _, t := range tags {
+		if _, ok := previous[t]; ok {
+			continue
+		}
+		info, described := c.imageInfo.Load(imageInfoKey{repo: repo, tag: t})
+		_, selected := isSelected[t]
+		if described || !selected {
+			c.emit(events.Event{Kind: events.TagCreated, Repository: repo, Tag: t, Digest: info.Digest})
+		}
+	}
+}
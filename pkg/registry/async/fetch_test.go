@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend/backendtest"
+	"github.com/seqeralabs/staticreg/pkg/registry/catalog"
+)
+
+// blockingSource never lists anything, so that no full synchronization completes until released
+type blockingSource struct {
+	release chan struct{}
+}
+
+var _ catalog.Source = blockingSource{}
+
+func (s blockingSource) Walk(ctx context.Context, cursor string, fn catalog.PageFunc) error {
+	select {
+	case <-s.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ctx, cancel := context.WithCancel(logger.Context(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	fake := backendtest.New()
+	fake.SetTag("team/app", "1.0", "sha256:aaaa")
+	c := New(fake, blockingSource{release: make(chan struct{})}, Config{RefreshInterval: time.Hour})
+	go func() { _ = c.Start(ctx) }()
+
+	if err := c.Fetch(ctx, "team/app"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := c.Snapshot().TagList(ctx, "team/app"); len(tags) != 1 {
+		t.Errorf("fetched tags %v", tags)
+	}
+
+	// a repository that does not exist is looked for once
+	for range 3 {
+		if err := c.Fetch(ctx, "team/nope"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.Calls(backendtest.OpTagList); got != 2 {
+		t.Errorf("listed tags %d times, want 2", got)
+	}
+
+	c.fetchLimiter = rate.NewLimiter(0, 0)
+	if err := c.Fetch(ctx, "team/other"); !errors.Is(err, ErrTooManyFetches) {
+		t.Errorf("got %v, want ErrTooManyFetches", err)
+	}
+}
+
+// waitLastSync waits for a full synchronization to complete
+func waitLastSync(t *testing.T, c *Async) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, ok := c.LastSync(); !ok; _, ok = c.LastSync() {
+		if time.Now().After(deadline) {
+			t.Fatal("no synchronization completed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFetchAfterSync(t *testing.T) {
+	ctx, cancel := context.WithCancel(logger.Context(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	fake := backendtest.New()
+	fake.SetTag("team/app", "1.0", "sha256:aaaa")
+	c := New(fake, catalog.NewRegistrySource(fake, 10), Config{RefreshInterval: time.Hour})
+	go func() { _ = c.Start(ctx) }()
+	waitLastSync(t, c)
+
+	// pushed after the synchronization, the next one is an hour away
+	fake.SetTag("team/new", "1.0", "sha256:bbbb")
+	if err := c.Fetch(ctx, "team/new"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := c.Snapshot().TagList(ctx, "team/new"); len(tags) != 1 {
+		t.Errorf("fetched tags %v", tags)
+	}
+}
+
+func TestFetchAfterLoadingState(t *testing.T) {
+	ctx, cancel := context.WithCancel(logger.Context(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	file := filepath.Join(t.TempDir(), "state.json.gz")
+	lastSync := SyncStats{Generation: 1, StartedAt: time.Now().Add(-time.Minute), FinishedAt: time.Now()}
+	saved := New(backendtest.New(), blockingSource{}, Config{StateFile: file})
+	saved.lastSync = &lastSync
+	saved.repositoryTags.Store("team/app", []string{"1.0"})
+	saved.saveState(ctx)
+
+	fake := backendtest.New()
+	fake.SetTag("team/app", "1.0", "sha256:aaaa")
+	fake.SetTag("team/new", "1.0", "sha256:bbbb")
+	// the synchronization after the restart never completes, only the saved state is known
+	c := New(fake, blockingSource{release: make(chan struct{})}, Config{RefreshInterval: time.Hour, StateFile: file})
+	go func() { _ = c.Start(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.Synchronized() {
+		if time.Now().After(deadline) {
+			t.Fatal("state not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := c.Fetch(ctx, "team/new"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := c.Snapshot().TagList(ctx, "team/new"); len(tags) != 1 {
+		t.Errorf("fetched tags %v", tags)
+	}
+}
+
+func TestForgetMissing(t *testing.T) {
+	fake := backendtest.New()
+	c := New(fake, blockingSource{}, Config{})
+	c.missing.Store("team/old", time.Now().Add(-missingTTL))
+	c.missing.Store("team/recent", time.Now())
+	c.forgetMissing()
+	if _, ok := c.missing.Load("team/old"); ok {
+		t.Error("repository missing for too long is still remembered")
+	}
+	if _, ok := c.missing.Load("team/recent"); !ok {
+		t.Error("repository missing recently is forgotten")
+	}
+}
@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend"
+	"github.com/seqeralabs/staticreg/pkg/registry/filter"
+)
+
+const (
+	// retryInitialInterval is how long to wait before retrying an item the first time,
+	// the delay doubles with every attempt up to retryMaxInterval
+	retryInitialInterval = 30 * time.Second
+	retryMaxInterval     = 10 * time.Minute
+	// retryTick is how often items due for a retry are looked for
+	retryTick = time.Second
+)
+
+// Retry is a repository, or a tag, that failed to synchronize and is going to be tried again
+type Retry struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	// Attempts is how many times in a row the item failed
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	NextAt   time.Time `json:"nextAt"`
+}
+
+// DeadLetter is a repository, or a tag, that is not retried anymore: because its error cannot be fixed
+// by retrying, like a missing repository or a denied access, or because it failed too many times in a row.
+// It is tried again by the next full synchronization.
+type DeadLetter struct {
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag,omitempty"`
+	Attempts   int       `json:"attempts"`
+	Permanent  bool      `json:"permanent"`
+	Error      string    `json:"error"`
+	At         time.Time `json:"at"`
+}
+
+// retryKey identifies the item to retry, the tag is empty for repositories
+func retryKey(repo string, tag string) imageInfoKey {
+	return imageInfoKey{repo: repo, tag: tag}
+}
+
+// scheduleRetry records that the item identified by key failed with err in run, and schedules it to be retried
+// unless err cannot be fixed by retrying or the item failed too many times in a row. Only failed retries
+// count as one more attempt, an item picked up again by a full synchronization or a refresh starts over.
+func (c *Async) scheduleRetry(ctx context.Context, run *syncRun, key imageInfoKey, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	log := logger.FromContext(ctx).With(slog.String("repo", key.repo), slog.String("tag", key.tag))
+
+	attempts := 1
+	if prev, ok := c.retries.Load(key); ok && run.retry {
+		attempts = prev.Attempts + 1
+	}
+
+	permanent := backend.IsPermanent(err)
+	if permanent || attempts > c.retryAttempts {
+		c.retries.Delete(key)
+		c.deadLetters.Store(key, DeadLetter{
+			Repository: key.repo,
+			Tag:        key.tag,
+			Attempts:   attempts,
+			Permanent:  permanent,
+			Error:      err.Error(),
+			At:         time.Now(),
+		})
+		log.Warn("giving up on retrying until the next synchronization", logger.ErrAttr(err), slog.Int("attempts", attempts), slog.Bool("permanent", permanent))
+		return
+	}
+
+	next := time.Now().Add(retryDelay(attempts))
+	c.deadLetters.Delete(key)
+	c.retries.Store(key, Retry{
+		Repository: key.repo,
+		Tag:        key.tag,
+		Attempts:   attempts,
+		Error:      err.Error(),
+		NextAt:     next,
+	})
+	log.Debug("retry scheduled", slog.Int("attempts", attempts), slog.Time("next", next))
+}
+
+// clearRetry forgets the failures of the item identified by key, which synchronized successfully or is gone
+func (c *Async) clearRetry(key imageInfoKey) {
+	c.retries.Delete(key)
+	c.deadLetters.Delete(key)
+}
+
+// retryDelay is how long to wait before the next attempt after attempts failures, with some jitter
+// so that items failing together are not retried all at once
+func retryDelay(attempts int) time.Duration {
+	delay := retryMaxInterval
+	if attempts < 16 {
+		delay = min(retryInitialInterval<<(attempts-1), retryMaxInterval)
+	}
+	return delay/2 + rand.N(delay/2)
+}
+
+// runRetries enqueues the items that are due for a retry until ctx is done
+func (c *Async) runRetries(ctx context.Context) error {
+	ticker := time.NewTicker(retryTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		due := []Retry{}
+		now := time.Now()
+		c.retries.Range(func(_ imageInfoKey, r Retry) bool {
+			if !r.NextAt.IsZero() && !r.NextAt.After(now) {
+				due = append(due, r)
+			}
+			return true
+		})
+		for _, r := range due {
+			if err := c.retry(ctx, r); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// retry enqueues r as a run of its own, the retry is only marked as in progress
+// so that a new failure counts as one more attempt
+func (c *Async) retry(ctx context.Context, r Retry) error {
+	key := retryKey(r.Repository, r.Tag)
+	if c.filter.Action(r.Repository) == filter.Exclude {
+		c.clearRetry(key)
+		return nil
+	}
+	r.NextAt = time.Time{}
+	c.retries.Store(key, r)
+
+	logger.FromContext(ctx).Debug("retrying", slog.String("repo", r.Repository), slog.String("tag", r.Tag), slog.Int("attempts", r.Attempts))
+	run := newRetryRun(func(*syncRun) {
+		c.publish()
+	})
+	run.add()
+	if r.Tag == "" {
+		select {
+		case c.repositoryRequests <- repositoryRequest{repo: r.Repository, run: run}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		select {
+		case c.imageInfoRequests <- imageInfoRequest{repo: r.Repository, tag: r.Tag, run: run}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	run.finishCatalog()
+	return nil
+}
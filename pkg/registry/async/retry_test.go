@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend/backendtest"
+	"github.com/seqeralabs/staticreg/pkg/registry/catalog"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+)
+
+func TestScheduleRetry(t *testing.T) {
+	ctx := logger.Context(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	fake := backendtest.New()
+	c := New(fake, catalog.NewRegistrySource(fake, 10), Config{RetryAttempts: 2})
+	key := retryKey("team/app", "1.0")
+	flaky := errors.New("connection reset by peer")
+
+	check := func(wantRetry bool, wantAttempts int) {
+		t.Helper()
+		r, retrying := c.retries.Load(key)
+		d, dead := c.deadLetters.Load(key)
+		switch {
+		case retrying == dead:
+			t.Fatalf("retrying %v and dead %v, want exactly one of them", retrying, dead)
+		case wantRetry && (!retrying || r.Attempts != wantAttempts):
+			t.Fatalf("got retry %+v, dead letter %+v, want a retry after %d attempts", r, d, wantAttempts)
+		case !wantRetry && (!dead || d.Attempts != wantAttempts):
+			t.Fatalf("got retry %+v, dead letter %+v, want a dead letter after %d attempts", r, d, wantAttempts)
+		}
+	}
+
+	fullSync := newSyncRun(1, nil)
+	c.scheduleRetry(ctx, fullSync, key, flaky)
+	check(true, 1)
+	c.scheduleRetry(ctx, newRetryRun(nil), key, flaky)
+	check(true, 2)
+	c.scheduleRetry(ctx, newRetryRun(nil), key, flaky)
+	check(false, 3)
+
+	// the next full synchronization starts over instead of giving up right away
+	c.scheduleRetry(ctx, newSyncRun(2, nil), key, flaky)
+	check(true, 1)
+	// and so do refreshes
+	c.scheduleRetry(ctx, newRetryRun(nil), key, flaky)
+	check(true, 2)
+	c.scheduleRetry(ctx, newSyncRun(0, nil), key, flaky)
+	check(true, 1)
+
+	c.scheduleRetry(ctx, fullSync, key, fmt.Errorf("%w: tag team/app:1.0", errs.ErrNotFound))
+	check(false, 1)
+	if d, _ := c.deadLetters.Load(key); !d.Permanent {
+		t.Error("missing tag not reported as permanent")
+	}
+
+	c.clearRetry(key)
+	if _, ok := c.retries.Load(key); ok {
+		t.Error("retry not cleared")
+	}
+	if _, ok := c.deadLetters.Load(key); ok {
+		t.Error("dead letter not cleared")
+	}
+}
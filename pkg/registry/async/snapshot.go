@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"context"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+	"github.com/seqeralabs/staticreg/pkg/registry/filter"
+)
+
+// publishInterval is how often the snapshot is published while a synchronization is in progress,
+// so that a long first synchronization shows its progress
+const publishInterval = 5 * time.Second
+
+// Snapshot is an immutable view of everything known about the registry at some point in time.
+// It is never modified once published, readers holding one always see consistent data.
+type Snapshot struct {
+	publishedAt time.Time
+	repos       map[string]registry.RepoData
+	tags        map[string][]string
+	imageInfo   map[imageInfoKey]registry.ImageInfo
+	untracked   map[imageInfoKey]struct{}
+	referrers   map[imageInfoKey][]registry.Referrer
+}
+
+var _ registry.Client = (*Snapshot)(nil)
+
+func emptySnapshot() *Snapshot {
+	return &Snapshot{
+		repos:     map[string]registry.RepoData{},
+		tags:      map[string][]string{},
+		imageInfo: map[imageInfoKey]registry.ImageInfo{},
+		untracked: map[imageInfoKey]struct{}{},
+		referrers: map[imageInfoKey][]registry.Referrer{},
+	}
+}
+
+// PublishedAt is when the snapshot was published, zero for the empty one served before anything is known
+func (s *Snapshot) PublishedAt() time.Time {
+	return s.publishedAt
+}
+
+// RepoList returns the repositories of the snapshot but the hidden ones, the map must not be modified
+func (s *Snapshot) RepoList(ctx context.Context) (map[string]registry.RepoData, error) {
+	return s.repos, nil
+}
+
+func (s *Snapshot) TagList(ctx context.Context, repo string) ([]string, error) {
+	tags, ok := s.tags[repo]
+	if !ok {
+		return nil, ErrNoTagsFound
+	}
+	return tags, nil
+}
+
+// ImageInfo returns the image info of a tag, errs.ErrUntracked if the tag is left out by the tag policy
+func (s *Snapshot) ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	key := imageInfoKey{repo: repo, tag: tag}
+	info, ok := s.imageInfo[key]
+	if _, untracked := s.untracked[key]; !ok && untracked {
+		return registry.ImageInfo{}, errs.ErrUntracked
+	}
+	if !ok {
+		return registry.ImageInfo{}, ErrImageInfoNotFound
+	}
+	return info, nil
+}
+
+// Referrers returns the artifacts attached to the image of a tag, nil if there are none or they are not known yet
+func (s *Snapshot) Referrers(ctx context.Context, repo string, tag string) ([]registry.Referrer, error) {
+	return s.referrers[imageInfoKey{repo: repo, tag: tag}], nil
+}
+
+// Snapshot returns the last published snapshot
+func (c *Async) Snapshot() registry.Client {
+	return c.snapshot.Load()
+}
+
+// publish builds a snapshot from what the crawler knows right now and swaps it in for readers.
+// Slices and image info stored by the crawler are never modified in place, they are shared with the snapshot.
+func (c *Async) publish() {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	c.snapshot.Store(c.buildSnapshot())
+}
+
+// maybePublish publishes a snapshot if none was published for a while and no other is being built
+func (c *Async) maybePublish() {
+	if time.Since(c.snapshot.Load().publishedAt) < publishInterval || !c.publishMu.TryLock() {
+		return
+	}
+	defer c.publishMu.Unlock()
+	c.snapshot.Store(c.buildSnapshot())
+}
+
+func (c *Async) buildSnapshot() *Snapshot {
+	s := &Snapshot{
+		publishedAt: time.Now(),
+		repos:       make(map[string]registry.RepoData, c.repositoryTags.Size()),
+		tags:        make(map[string][]string, c.repositoryTags.Size()),
+		imageInfo:   make(map[imageInfoKey]registry.ImageInfo, c.imageInfo.Size()),
+		untracked:   map[imageInfoKey]struct{}{},
+		referrers:   make(map[imageInfoKey][]registry.Referrer, c.referrers.Size()),
+	}
+	c.repositoryTags.Range(func(repo string, tags []string) bool {
+		// repositories excluded since they were crawled are gone right away,
+		// hidden ones can still be opened but are not listed
+		action := c.filter.Action(repo)
+		if action == filter.Exclude {
+			return true
+		}
+		s.tags[repo] = tags
+		for _, t := range tags {
+			key := imageInfoKey{repo: repo, tag: t}
+			if info, ok := c.imageInfo.Load(key); ok {
+				s.imageInfo[key] = info
+			} else if _, ok := c.untrackedTags.Load(key); ok {
+				s.untracked[key] = struct{}{}
+			}
+			if referrers, ok := c.referrers.Load(key); ok {
+				s.referrers[key] = referrers
+			}
+		}
+		if action == filter.Hide {
+			return true
+		}
+		if repoData, ok := s.repoData(repo); ok {
+			s.repos[repo] = repoData
+		}
+		return true
+	})
+	return s
+}
+
+// repoData describes repo after its most recently created tag, false if no tag of repo is known.
+// A repository whose tags are all left out by the tag policy is known by its name only.
+func (s *Snapshot) repoData(repo string) (registry.RepoData, bool) {
+	repoData := registry.RepoData{Name: repo}
+	found, untracked := false, false
+	for _, t := range s.tags[repo] {
+		key := imageInfoKey{repo: repo, tag: t}
+		info, ok := s.imageInfo[key]
+		if !ok {
+			_, isUntracked := s.untracked[key]
+			untracked = untracked || isUntracked
+			continue
+		}
+		if createdAt := info.CreatedAt(); !found || createdAt.After(repoData.LastUpdatedAt) {
+			repoData.LastUpdatedAt = createdAt
+			repoData.PullReference = info.Reference
+			repoData.PullCommand = info.PullCommand
+			found = true
+		}
+	}
+	return repoData, found || untracked
+}
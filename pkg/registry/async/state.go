@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+// stateVersion is the version of the state file format, it must be bumped with every incompatible change
+// and a migration added to stateMigrations if the previous format can be converted
+const stateVersion = 2
+
+var (
+	ErrStateVersion = errors.New("unsupported state version")
+)
+
+// stateMigrations convert the state files written by a previous version into the current format,
+// state files with no migration are discarded and the registry is crawled from scratch
+var stateMigrations = map[int]func(data []byte) (*state, error){
+	1: migrateStateV1,
+}
+
+// state is what is saved to disk to serve a complete registry right after a restart
+type state struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"savedAt"`
+	// Generation is the generation of the last full synchronization, what is loaded is marked with it
+	Generation   uint64            `json:"generation"`
+	LastSync     *SyncStats        `json:"lastSync,omitempty"`
+	LastSyncedAt time.Time         `json:"lastSyncedAt"`
+	Repositories []stateRepository `json:"repositories"`
+}
+
+type stateRepository struct {
+	Name string     `json:"name"`
+	Tags []stateTag `json:"tags"`
+}
+
+type stateTag struct {
+	Name string              `json:"name"`
+	Info *registry.ImageInfo `json:"info,omitempty"`
+	// Untracked is set for the tags left out by the tag policy
+	Untracked bool                `json:"untracked,omitempty"`
+	Referrers []registry.Referrer `json:"referrers,omitempty"`
+}
+
+// saveState writes what is known about the registry to the state file, replacing it atomically
+func (c *Async) saveState(ctx context.Context) {
+	if c.stateFile == "" {
+		return
+	}
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	log := logger.FromContext(ctx).With(slog.String("state-file", c.stateFile))
+	s := c.buildState()
+	if err := writeState(c.stateFile, s); err != nil {
+		log.Error("could not save state", logger.ErrAttr(err))
+		return
+	}
+	log.Debug("state saved", slog.Int("repositories", len(s.Repositories)))
+}
+
+func (c *Async) buildState() *state {
+	s := &state{
+		Version:      stateVersion,
+		SavedAt:      time.Now(),
+		Generation:   c.generation.Load(),
+		LastSyncedAt: c.Health().LastSyncedAt,
+		Repositories: make([]stateRepository, 0, c.repositoryTags.Size()),
+	}
+	if lastSync, ok := c.LastSync(); ok {
+		s.LastSync = &lastSync
+	}
+	c.repositoryTags.Range(func(repo string, tags []string) bool {
+		r := stateRepository{
+			Name: repo,
+			Tags: make([]stateTag, 0, len(tags)),
+		}
+		for _, t := range tags {
+			key := imageInfoKey{repo: repo, tag: t}
+			tag := stateTag{Name: t}
+			if info, ok := c.imageInfo.Load(key); ok {
+				tag.Info = &info
+			}
+			_, tag.Untracked = c.untrackedTags.Load(key)
+			tag.Referrers, _ = c.referrers.Load(key)
+			r.Tags = append(r.Tags, tag)
+		}
+		s.Repositories = append(s.Repositories, r)
+		return true
+	})
+	return s
+}
+
+func writeState(path string, s *state) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	if err := json.NewEncoder(gz).Encode(s); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// loadState fills the crawler with what was saved by a previous run. A missing, unreadable or unsupported
+// state file is not an error, the registry is just crawled from scratch.
+func (c *Async) loadState(ctx context.Context) {
+	if c.stateFile == "" {
+		return
+	}
+	log := logger.FromContext(ctx).With(slog.String("state-file", c.stateFile))
+
+	s, err := readState(c.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info("no state saved yet, starting from an empty registry")
+		return
+	}
+	if err != nil {
+		log.Warn("discarding saved state", logger.ErrAttr(err))
+		return
+	}
+
+	tags := 0
+	for _, r := range s.Repositories {
+		names := make([]string, 0, len(r.Tags))
+		for _, t := range r.Tags {
+			key := imageInfoKey{repo: r.Name, tag: t.Name}
+			names = append(names, t.Name)
+			if t.Info != nil {
+				c.imageInfo.Store(key, *t.Info)
+			}
+			if t.Untracked {
+				c.untrackedTags.Store(key, struct{}{})
+			}
+			if t.Referrers != nil {
+				c.referrers.Store(key, t.Referrers)
+			}
+			c.tagGenerations.Store(key, s.Generation)
+		}
+		c.repositoryTags.Store(r.Name, names)
+		c.repoGenerations.Store(r.Name, s.Generation)
+		tags += len(names)
+	}
+	c.generation.Store(s.Generation)
+	if s.LastSync != nil {
+		c.lastSyncMu.Lock()
+		c.lastSync = s.LastSync
+		c.lastSyncMu.Unlock()
+	}
+	c.healthMu.Lock()
+	c.health.LastSyncedAt = s.LastSyncedAt
+	c.healthMu.Unlock()
+	c.publish()
+	c.stateLoaded.Store(true)
+
+	log.Info("state loaded",
+		slog.Time("saved-at", s.SavedAt),
+		slog.Uint64("generation", s.Generation),
+		slog.Int("repositories", len(s.Repositories)),
+		slog.Int("tags", tags),
+	)
+}
+
+// migrateStateV1 keeps what version 1 knew, which lacked the image configuration and layer count.
+// Digests are cleared so that every tag is described again during the next synchronization.
+func migrateStateV1(data []byte) (*state, error) {
+	s := &state{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	for _, r := range s.Repositories {
+		for _, t := range r.Tags {
+			if t.Info != nil {
+				t.Info.Digest = ""
+			}
+		}
+	}
+	s.Version = stateVersion
+	return s, nil
+}
+
+func readState(path string) (*state, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.Version != stateVersion {
+		migrate, ok := stateMigrations[header.Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d, expected %d", ErrStateVersion, header.Version, stateVersion)
+		}
+		return migrate(data)
+	}
+
+	s := &state{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
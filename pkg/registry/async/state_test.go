@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend/backendtest"
+	"github.com/seqeralabs/staticreg/pkg/registry/catalog"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+)
+
+func stateContext() context.Context {
+	return logger.Context(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func newStateCrawler(stateFile string) *Async {
+	fake := backendtest.New()
+	return New(fake, catalog.NewRegistrySource(fake, 10), Config{StateFile: stateFile})
+}
+
+// requireAllFields fails if a field of v is left to its zero value, so that a field added
+// to what is persisted has to be added to the round trip below as well
+func requireAllFields(t *testing.T, v any) {
+	t.Helper()
+	rv := reflect.ValueOf(v)
+	for i := range rv.NumField() {
+		if rv.Field(i).IsZero() {
+			t.Fatalf("%s.%s is not set, the state round trip would not notice it is lost", rv.Type().Name(), rv.Type().Field(i).Name)
+		}
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	ctx := stateContext()
+	file := filepath.Join(t.TempDir(), "state", "registry.json.gz")
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	platform := registry.PlatformData{
+		Platform:     "linux/arm64/v8",
+		Digest:       "sha256:bbbb",
+		MediaType:    "application/vnd.oci.image.manifest.v1+json",
+		Size:         2048,
+		Layers:       3,
+		CreatedAt:    created,
+		Labels:       map[string]string{"org.opencontainers.image.source": "https://github.com/example/app"},
+		Annotations:  map[string]string{"org.opencontainers.image.ref.name": "1.0"},
+		Entrypoint:   []string{"/app"},
+		Cmd:          []string{"serve"},
+		ExposedPorts: []string{"8080/tcp"},
+	}
+	info := registry.ImageInfo{
+		Reference:   "registry.example.com/library/app:1.0",
+		PullCommand: "docker pull registry.example.com/library/app:1.0",
+		Digest:      "sha256:1111",
+		MediaType:   "application/vnd.oci.image.index.v1+json",
+		Index:       true,
+		Platforms:   []registry.PlatformData{platform},
+		Artifact:    &registry.Artifact{Kind: registry.ArtifactKindGeneric, Type: "application/vnd.example"},
+	}
+	referrer := registry.Referrer{
+		ArtifactType: "application/vnd.dev.sigstore.bundle.v0.3+json",
+		Digest:       "sha256:5151",
+		MediaType:    "application/vnd.oci.image.manifest.v1+json",
+		Size:         512,
+		Annotations:  map[string]string{"dev.sigstore.bundle.predicateType": "https://slsa.dev/provenance/v1"},
+		Tag:          "sha256-1111.sig",
+	}
+	requireAllFields(t, platform)
+	requireAllFields(t, info)
+	requireAllFields(t, referrer)
+
+	lastSync := SyncStats{
+		Generation:   4,
+		StartedAt:    created,
+		FinishedAt:   created.Add(time.Minute),
+		Repositories: 1,
+		TagsNew:      2,
+	}
+	saved := newStateCrawler(file)
+	saved.generation.Store(4)
+	saved.lastSync = &lastSync
+	saved.health.LastSyncedAt = lastSync.FinishedAt
+	saved.repositoryTags.Store("library/app", []string{"1.0", "nightly"})
+	saved.repositoryTags.Store("library/empty", []string{})
+	saved.imageInfo.Store(imageInfoKey{repo: "library/app", tag: "1.0"}, info)
+	saved.referrers.Store(imageInfoKey{repo: "library/app", tag: "1.0"}, []registry.Referrer{referrer})
+	saved.untrackedTags.Store(imageInfoKey{repo: "library/app", tag: "nightly"}, struct{}{})
+	saved.saveState(ctx)
+
+	loaded := newStateCrawler(file)
+	loaded.loadState(ctx)
+	if !loaded.Synchronized() {
+		t.Fatal("state not loaded")
+	}
+	if got := loaded.generation.Load(); got != 4 {
+		t.Errorf("generation %d, want 4", got)
+	}
+	if got, _ := loaded.LastSync(); !reflect.DeepEqual(got, lastSync) {
+		t.Errorf("last sync %+v, want %+v", got, lastSync)
+	}
+	if got := loaded.Health().LastSyncedAt; !got.Equal(lastSync.FinishedAt) {
+		t.Errorf("last synced at %v, want %v", got, lastSync.FinishedAt)
+	}
+
+	s := loaded.Snapshot()
+	if tags, _ := s.TagList(ctx, "library/app"); !reflect.DeepEqual(tags, []string{"1.0", "nightly"}) {
+		t.Errorf("tags %v", tags)
+	}
+	if tags, err := s.TagList(ctx, "library/empty"); err != nil || len(tags) != 0 {
+		t.Errorf("tags of the empty repository %v, %v", tags, err)
+	}
+	if got, err := s.ImageInfo(ctx, "library/app", "1.0"); err != nil || !reflect.DeepEqual(got, info) {
+		t.Errorf("image info %+v, %v, want %+v", got, err, info)
+	}
+	if _, err := s.ImageInfo(ctx, "library/app", "nightly"); !errors.Is(err, errs.ErrUntracked) {
+		t.Errorf("got %v for the untracked tag, want errs.ErrUntracked", err)
+	}
+	if got, _ := s.Referrers(ctx, "library/app", "1.0"); !reflect.DeepEqual(got, []registry.Referrer{referrer}) {
+		t.Errorf("referrers %+v", got)
+	}
+	if got, ok := loaded.tagGenerations.Load(imageInfoKey{repo: "library/app", tag: "1.0"}); !ok || got != 4 {
+		t.Errorf("tag generation %d, want the generation of the state", got)
+	}
+}
+
+// writeStateFixture compresses a state file from testdata like saveState does
+func writeStateFixture(t *testing.T, fixture string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "registry.json.gz")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestStateMigrationV1(t *testing.T) {
+	ctx := stateContext()
+	c := newStateCrawler(writeStateFixture(t, "state-v1.json"))
+	c.loadState(ctx)
+	if !c.Synchronized() {
+		t.Fatal("version 1 state not loaded")
+	}
+	if got := c.generation.Load(); got != 7 {
+		t.Errorf("generation %d, want 7", got)
+	}
+	if lastSync, _ := c.LastSync(); lastSync.Generation != 7 || lastSync.TagsNew != 3 {
+		t.Errorf("last sync %+v", lastSync)
+	}
+
+	s := c.Snapshot()
+	repos, _ := s.RepoList(ctx)
+	if len(repos) != 2 {
+		t.Fatalf("repositories %v, want 2", repos)
+	}
+	if tags, _ := s.TagList(ctx, "library/app"); !reflect.DeepEqual(tags, []string{"1.0", "latest"}) {
+		t.Errorf("tags %v", tags)
+	}
+
+	info, err := s.ImageInfo(ctx, "library/app", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// digests are cleared so that the next synchronization describes every tag again
+	if info.Digest != "" {
+		t.Errorf("digest %q kept, want it cleared", info.Digest)
+	}
+	if info.Reference != "registry.example.com/library/app:1.0" || !info.Index || len(info.Platforms) != 2 {
+		t.Errorf("image info %+v", info)
+	}
+	if p := info.Platforms[1]; p.Platform != "linux/arm64/v8" || p.Size != 2048 || !p.CreatedAt.Equal(time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC)) {
+		t.Errorf("platform %+v", p)
+	}
+	if got, _ := s.Referrers(ctx, "library/app", "1.0"); len(got) != 1 || got[0].Digest != "sha256:5151" {
+		t.Errorf("referrers %+v", got)
+	}
+	chart, err := s.ImageInfo(ctx, "charts/web", "0.1.0")
+	if err != nil || chart.Artifact == nil || chart.Artifact.Kind != registry.ArtifactKindHelm || chart.Digest != "" {
+		t.Errorf("chart %+v, %v", chart, err)
+	}
+}
+
+func TestStateDiscarded(t *testing.T) {
+	dir := t.TempDir()
+	unsupported := filepath.Join(dir, "unsupported.json.gz")
+	if err := writeState(unsupported, &state{Version: stateVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := filepath.Join(dir, "corrupt.json.gz")
+	if err := os.WriteFile(corrupt, []byte("not gzip"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readState(unsupported); !errors.Is(err, ErrStateVersion) {
+		t.Errorf("got %v, want ErrStateVersion", err)
+	}
+
+	for _, file := range []string{unsupported, corrupt, filepath.Join(dir, "missing.json.gz")} {
+		c := newStateCrawler(file)
+		c.loadState(stateContext())
+		if c.Synchronized() {
+			t.Errorf("%s: state loaded, want it discarded", filepath.Base(file))
+		}
+	}
+}
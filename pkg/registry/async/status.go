@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"sort"
+	"time"
+)
+
+// Phase is what the crawler is busy with
+type Phase string
+
+const (
+	// PhaseIdle is between two full synchronizations
+	PhaseIdle Phase = "idle"
+	// PhaseCatalog is while the catalog is walked and repositories are enqueued
+	PhaseCatalog Phase = "catalog"
+	// PhaseTags is once the catalog is walked, while the remaining tags are synchronized
+	PhaseTags Phase = "tags"
+)
+
+// ItemError is the last error met synchronizing a repository, or one of its tags
+type ItemError struct {
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag,omitempty"`
+	Error      string    `json:"error"`
+	At         time.Time `json:"at"`
+}
+
+// Status describes the synchronization of the registry
+type Status struct {
+	Phase Phase `json:"phase"`
+	// Current is the progress of the full synchronization in progress, nil when idle
+	Current *SyncStats `json:"current,omitempty"`
+	// LastSync is the last completed full synchronization, nil if none completed yet
+	LastSync *SyncStats `json:"lastSync,omitempty"`
+	// LastError is the error of the last catalog walk, empty if it succeeded
+	LastError string `json:"lastError,omitempty"`
+	// Errors are the repositories and tags that failed to synchronize the last time they were tried,
+	// sorted by repository and tag
+	Errors []ItemError `json:"errors"`
+	// Retries are the repositories and tags waiting to be tried again, sorted by next attempt
+	Retries []Retry `json:"retries"`
+	// DeadLetters are the repositories and tags that are not retried anymore until the next full synchronization,
+	// sorted by repository and tag
+	DeadLetters []DeadLetter `json:"deadLetters"`
+}
+
+// Status returns the current status of the synchronization
+func (c *Async) Status() Status {
+	status := Status{
+		Phase:       PhaseIdle,
+		Errors:      []ItemError{},
+		Retries:     []Retry{},
+		DeadLetters: []DeadLetter{},
+	}
+	if run := c.current.Load(); run != nil {
+		status.Phase = PhaseCatalog
+		if run.catalogDone.Load() {
+			status.Phase = PhaseTags
+		}
+		current := run.stats()
+		current.FinishedAt = time.Time{}
+		status.Current = &current
+	}
+	if lastSync, ok := c.LastSync(); ok {
+		status.LastSync = &lastSync
+	}
+	if err := c.Health().LastError; err != nil {
+		status.LastError = err.Error()
+	}
+
+	c.repoErrors.Range(func(_ string, e ItemError) bool {
+		status.Errors = append(status.Errors, e)
+		return true
+	})
+	c.tagErrors.Range(func(_ imageInfoKey, e ItemError) bool {
+		status.Errors = append(status.Errors, e)
+		return true
+	})
+	sort.Slice(status.Errors, func(i, j int) bool {
+		if status.Errors[i].Repository != status.Errors[j].Repository {
+			return status.Errors[i].Repository < status.Errors[j].Repository
+		}
+		return status.Errors[i].Tag < status.Errors[j].Tag
+	})
+
+	c.retries.Range(func(_ imageInfoKey, r Retry) bool {
+		status.Retries = append(status.Retries, r)
+		return true
+	})
+	sort.Slice(status.Retries, func(i, j int) bool {
+		// retries in progress have no next attempt and come first
+		return status.Retries[i].NextAt.Before(status.Retries[j].NextAt)
+	})
+	c.deadLetters.Range(func(_ imageInfoKey, d DeadLetter) bool {
+		status.DeadLetters = append(status.DeadLetters, d)
+		return true
+	})
+	sort.Slice(status.DeadLetters, func(i, j int) bool {
+		if status.DeadLetters[i].Repository != status.DeadLetters[j].Repository {
+			return status.DeadLetters[i].Repository < status.DeadLetters[j].Repository
+		}
+		return status.DeadLetters[i].Tag < status.DeadLetters[j].Tag
+	})
+	return status
+}
+
+// LastSyncCompletedAt is when the last full synchronization completed, zero if none did yet
+func (c *Async) LastSyncCompletedAt() time.Time {
+	lastSync, ok := c.LastSync()
+	if !ok {
+		return time.Time{}
+	}
+	return lastSync.FinishedAt
+}
+
+// recordRepositoryError remembers err as the last error of repo, a nil err clears it
+func (c *Async) recordRepositoryError(repo string, err error) {
+	if err == nil {
+		c.repoErrors.Delete(repo)
+		return
+	}
+	c.repoErrors.Store(repo, ItemError{
+		Repository: repo,
+		Error:      err.Error(),
+		At:         time.Now(),
+	})
+}
+
+// recordTagError remembers err as the last error of the tag, a nil err clears it
+func (c *Async) recordTagError(key imageInfoKey, err error) {
+	if err == nil {
+		c.tagErrors.Delete(key)
+		return
+	}
+	c.tagErrors.Store(key, ItemError{
+		Repository: key.repo,
+		Tag:        key.tag,
+		Error:      err.Error(),
+		At:         time.Now(),
+	})
+}
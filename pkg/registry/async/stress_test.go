@@ -0,0 +1,253 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend/backendtest"
+	"github.com/seqeralabs/staticreg/pkg/registry/catalog"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+)
+
+const (
+	stressRepos = 12
+	stressTags  = 8
+)
+
+// TestStress runs full synchronizations, on-demand refreshes, deletions and snapshot publishing
+// against a registry that keeps changing, while readers check every snapshot they get.
+// It is meant to be run with the race detector.
+func TestStress(t *testing.T) {
+	ctx, cancel := context.WithCancel(logger.Context(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+
+	fake := backendtest.New()
+	// model is what the fake holds, only the mutator changes it once the crawler is started
+	model := map[string]map[string]string{}
+	setTag := func(repo, tag, digest string) {
+		fake.SetTag(repo, tag, digest)
+		if model[repo] == nil {
+			model[repo] = map[string]string{}
+		}
+		model[repo][tag] = digest
+	}
+	for r := range stressRepos {
+		for tg := range stressTags {
+			setTag(stressRepo(r), stressTag(tg), "sha256:0")
+		}
+	}
+
+	c := New(fake, catalog.NewRegistrySource(fake, 5), Config{
+		RefreshInterval:  10 * time.Millisecond,
+		TagWorkers:       3,
+		ImageInfoWorkers: 4,
+		StateFile:        filepath.Join(t.TempDir(), "state.json"),
+		RetryAttempts:    2,
+	})
+	sub := c.Subscribe("stress", 16)
+	defer sub.Close()
+
+	started := make(chan error, 1)
+	go func() { started <- c.Start(ctx) }()
+
+	stressCtx, stop := context.WithTimeout(ctx, time.Second)
+	defer stop()
+	var wg sync.WaitGroup
+	spawn := func(f func(rng *rand.Rand)) {
+		wg.Add(1)
+		seed := rand.Uint64()
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(seed, seed))
+			for stressCtx.Err() == nil {
+				f(rng)
+			}
+		}()
+	}
+
+	// the registry keeps changing and failing now and then
+	spawn(func(rng *rand.Rand) {
+		repo, tag := stressRepo(rng.IntN(stressRepos)), stressTag(rng.IntN(stressTags))
+		switch rng.IntN(10) {
+		case 0:
+			fake.DeleteTag(repo, tag)
+			delete(model[repo], tag)
+		case 1:
+			fake.Fail(backendtest.OpImageInfo, errors.New("connection reset by peer"), 1)
+		case 2:
+			fake.Fail(backendtest.OpTagList, errors.New("connection reset by peer"), 1)
+		default:
+			setTag(repo, tag, fmt.Sprintf("sha256:%d", rng.IntN(1000)))
+		}
+		time.Sleep(time.Millisecond)
+	})
+	// webhooks and visitors ask for repositories and tags ahead of the catalog walk
+	spawn(func(rng *rand.Rand) {
+		repo, tag := stressRepo(rng.IntN(stressRepos)), stressTag(rng.IntN(stressTags))
+		switch rng.IntN(5) {
+		case 0:
+			c.DeleteTag(repo, tag)
+		case 1:
+			c.DeleteDigest(repo, fmt.Sprintf("sha256:%d", rng.IntN(1000)))
+		case 2:
+			_ = c.Refresh(ctx, repo, "", nil)
+		case 3:
+			fetchCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			_ = c.Fetch(fetchCtx, repo)
+			cancel()
+		default:
+			_ = c.Refresh(ctx, repo, tag, nil)
+		}
+		time.Sleep(time.Millisecond)
+	})
+	spawn(func(rng *rand.Rand) {
+		c.publish()
+		c.maybePublish()
+		_ = c.Status()
+		_, _ = c.LastSync()
+		time.Sleep(time.Millisecond)
+	})
+	spawn(func(rng *rand.Rand) {
+		select {
+		case <-sub.Events():
+		case <-time.After(time.Millisecond):
+		}
+	})
+	for range 4 {
+		spawn(func(rng *rand.Rand) {
+			if err := checkSnapshot(ctx, c.Snapshot()); err != nil {
+				t.Error(err)
+				stop()
+			}
+			repo, tag := stressRepo(rng.IntN(stressRepos)), stressTag(rng.IntN(stressTags))
+			_, _ = c.TagList(ctx, repo)
+			_, _ = c.ImageInfo(ctx, repo, tag)
+			_, _ = c.Referrers(ctx, repo, tag)
+			_, _ = c.RepoList(ctx)
+		})
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	// once the registry settles, the next synchronizations catch up with it
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		err := matchModel(ctx, c.Snapshot(), model)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the snapshot did not catch up with the registry: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-started; !errors.Is(err, context.Canceled) {
+		t.Errorf("Start returned %v, want context.Canceled", err)
+	}
+}
+
+// checkSnapshot reads s twice and checks it is consistent and did not change in between
+func checkSnapshot(ctx context.Context, s registry.Client) error {
+	repos, err := s.RepoList(ctx)
+	if err != nil {
+		return err
+	}
+	first := maps.Clone(repos)
+	tags := map[string][]string{}
+	infos := map[imageInfoKey]registry.ImageInfo{}
+	for repo := range repos {
+		list, err := s.TagList(ctx, repo)
+		if err != nil {
+			return fmt.Errorf("repository %s is listed but has no tags: %w", repo, err)
+		}
+		tags[repo] = slices.Clone(list)
+		for _, tag := range list {
+			info, err := s.ImageInfo(ctx, repo, tag)
+			switch {
+			case errors.Is(err, ErrImageInfoNotFound), errors.Is(err, errs.ErrUntracked):
+			case err != nil:
+				return err
+			case info.Reference != repo+":"+tag:
+				return fmt.Errorf("tag %s:%s has the image info of %s", repo, tag, info.Reference)
+			default:
+				infos[imageInfoKey{repo: repo, tag: tag}] = info
+			}
+		}
+	}
+
+	repos, _ = s.RepoList(ctx)
+	if !maps.Equal(first, repos) {
+		return errors.New("the repositories of a snapshot changed")
+	}
+	for repo, list := range tags {
+		again, _ := s.TagList(ctx, repo)
+		if !slices.Equal(list, again) {
+			return fmt.Errorf("the tags of %s changed in a snapshot: %v then %v", repo, list, again)
+		}
+	}
+	for key, info := range infos {
+		again, err := s.ImageInfo(ctx, key.repo, key.tag)
+		if err != nil || again.Digest != info.Digest {
+			return fmt.Errorf("the image info of %s:%s changed in a snapshot", key.repo, key.tag)
+		}
+	}
+	return nil
+}
+
+// matchModel tells how s differs from the tags and digests of model
+func matchModel(ctx context.Context, s registry.Client, model map[string]map[string]string) error {
+	for repo, want := range model {
+		list, _ := s.TagList(ctx, repo)
+		if len(list) != len(want) {
+			return fmt.Errorf("%s has tags %v, want %d of them", repo, list, len(want))
+		}
+		for tag, digest := range want {
+			info, err := s.ImageInfo(ctx, repo, tag)
+			if err != nil {
+				return fmt.Errorf("%s:%s: %w", repo, tag, err)
+			}
+			if info.Digest != digest {
+				return fmt.Errorf("%s:%s is %s, want %s", repo, tag, info.Digest, digest)
+			}
+		}
+	}
+	return nil
+}
+
+func stressRepo(i int) string {
+	return fmt.Sprintf("team/app%d", i)
+}
+
+func stressTag(i int) string {
+	return fmt.Sprintf("v%d", i)
+}
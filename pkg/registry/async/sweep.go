@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+)
+
+// markRepository records that repo was seen by run
+func (c *Async) markRepository(run *syncRun, repo string) {
+	c.repoGenerations.Store(repo, c.runGeneration(run))
+}
+
+// markTags records that the tags of repo were seen by run
+func (c *Async) markTags(run *syncRun, repo string, tags []string) {
+	gen := c.runGeneration(run)
+	for _, t := range tags {
+		c.tagGenerations.Store(imageInfoKey{repo: repo, tag: t}, gen)
+	}
+}
+
+// runGeneration is the generation entries seen by run are marked with. Runs that are not
+// full synchronizations mark what they see with the generation in progress, so that
+// it is not evicted when that generation completes.
+func (c *Async) runGeneration(run *syncRun) uint64 {
+	if run.generation != 0 {
+		return run.generation
+	}
+	return c.generation.Load()
+}
+
+// sweep evicts the repositories and tags that were not seen by run, which must have walked
+// the whole catalog. It returns how many repositories and tags were removed.
+func (c *Async) sweep(ctx context.Context, run *syncRun) (int64, int64) {
+	log := logger.FromContext(ctx).With(slog.Uint64("generation", run.generation))
+
+	if run.repositories.Load()+run.repositoriesExcluded.Load() == 0 && c.repoGenerations.Size() > 0 {
+		// more likely a registry hiccup than every repository being deleted at once
+		log.Warn("catalog walk returned no repositories, not evicting anything")
+		return 0, 0
+	}
+
+	repos := []string{}
+	c.repoGenerations.Range(func(repo string, gen uint64) bool {
+		if gen < run.generation {
+			repos = append(repos, repo)
+		}
+		return true
+	})
+	for _, repo := range repos {
+		c.deleteRepository(repo)
+	}
+
+	tags := map[string][]string{}
+	c.tagGenerations.Range(func(key imageInfoKey, gen uint64) bool {
+		if gen < run.generation {
+			tags[key.repo] = append(tags[key.repo], key.tag)
+		}
+		return true
+	})
+	evictedTags := int64(0)
+	for repo, stale := range tags {
+		for _, tag := range stale {
+			c.deleteTag(repo, tag)
+			evictedTags++
+		}
+	}
+
+	log.Info("evicted entries not seen anymore", slog.Int("repositories", len(repos)), slog.Int64("tags", evictedTags))
+	return int64(len(repos)), evictedTags
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package async
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncStats summarizes a full synchronization of the registry
+type SyncStats struct {
+	// Generation identifies the synchronization, it grows with every full synchronization
+	Generation uint64    `json:"generation"`
+	StartedAt  time.Time `json:"startedAt"`
+	// FinishedAt is zero while the synchronization is in progress
+	FinishedAt time.Time `json:"finishedAt"`
+
+	Repositories       int64 `json:"repositories"`
+	RepositoriesFailed int64 `json:"repositoriesFailed"`
+	// RepositoriesExcluded were listed by the catalog but not crawled because of the filter
+	RepositoriesExcluded int64 `json:"repositoriesExcluded"`
+
+	// TagsUnchanged were skipped because their digest did not change since the previous synchronization
+	TagsUnchanged int64 `json:"tagsUnchanged"`
+	// TagsUpdated point to a different digest than they did in the previous synchronization
+	TagsUpdated int64 `json:"tagsUpdated"`
+	// TagsNew were not known before this synchronization
+	TagsNew    int64 `json:"tagsNew"`
+	TagsFailed int64 `json:"tagsFailed"`
+	// TagsUntracked are left out by the tag policy, they are listed without their image info
+	TagsUntracked int64 `json:"tagsUntracked"`
+
+	// RepositoriesEvicted and TagsEvicted were not seen anymore and have been removed
+	RepositoriesEvicted int64 `json:"repositoriesEvicted"`
+	TagsEvicted         int64 `json:"tagsEvicted"`
+}
+
+func (s SyncStats) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("generation", s.Generation),
+		slog.Duration("duration", s.FinishedAt.Sub(s.StartedAt)),
+		slog.Int64("repositories", s.Repositories),
+		slog.Int64("repositories-failed", s.RepositoriesFailed),
+		slog.Int64("repositories-excluded", s.RepositoriesExcluded),
+		slog.Int64("tags-unchanged", s.TagsUnchanged),
+		slog.Int64("tags-updated", s.TagsUpdated),
+		slog.Int64("tags-new", s.TagsNew),
+		slog.Int64("tags-failed", s.TagsFailed),
+		slog.Int64("tags-untracked", s.TagsUntracked),
+		slog.Int64("repositories-evicted", s.RepositoriesEvicted),
+		slog.Int64("tags-evicted", s.TagsEvicted),
+	)
+}
+
+// syncRun tracks a full synchronization while its work flows through the crawler stages.
+// Every request enqueued on behalf of the run is counted as pending until it is handled,
+// the run is complete once the catalog has been walked and nothing is pending anymore.
+type syncRun struct {
+	// generation is zero for runs that synchronize a single repository or tag, they never evict anything
+	generation uint64
+	startedAt  time.Time
+	// retry is set for runs retrying an item that failed, they do not skip the queue
+	retry bool
+
+	pending     atomic.Int64
+	catalogDone atomic.Bool
+	completed   sync.Once
+	onComplete  func(*syncRun)
+
+	repositories         atomic.Int64
+	repositoriesFailed   atomic.Int64
+	repositoriesExcluded atomic.Int64
+	tagsUnchanged        atomic.Int64
+	tagsUpdated          atomic.Int64
+	tagsNew              atomic.Int64
+	tagsFailed           atomic.Int64
+	tagsUntracked        atomic.Int64
+}
+
+func newSyncRun(generation uint64, onComplete func(*syncRun)) *syncRun {
+	return &syncRun{
+		generation: generation,
+		startedAt:  time.Now(),
+		onComplete: onComplete,
+	}
+}
+
+// newRetryRun returns a run retrying a single repository or tag that failed to synchronize
+func newRetryRun(onComplete func(*syncRun)) *syncRun {
+	r := newSyncRun(0, onComplete)
+	r.retry = true
+	return r
+}
+
+// priority tells if the requests of the run skip the queue, runs that are not full synchronizations
+// nor retries were asked for by users or registries and are expected to complete quickly
+func (r *syncRun) priority() bool {
+	return r.generation == 0 && !r.retry
+}
+
+// add must be called before enqueuing a request for the run
+func (r *syncRun) add() {
+	r.pending.Add(1)
+}
+
+// done must be called once a request of the run has been handled
+func (r *syncRun) done() {
+	if r.pending.Add(-1) == 0 && r.catalogDone.Load() {
+		r.complete()
+	}
+}
+
+// finishCatalog marks the catalog as fully walked, no more repositories will be added to the run
+func (r *syncRun) finishCatalog() {
+	r.catalogDone.Store(true)
+	if r.pending.Load() == 0 {
+		r.complete()
+	}
+}
+
+func (r *syncRun) complete() {
+	r.completed.Do(func() {
+		r.onComplete(r)
+	})
+}
+
+func (r *syncRun) stats() SyncStats {
+	return SyncStats{
+		Generation:           r.generation,
+		StartedAt:            r.startedAt,
+		FinishedAt:           time.Now(),
+		Repositories:         r.repositories.Load(),
+		RepositoriesFailed:   r.repositoriesFailed.Load(),
+		RepositoriesExcluded: r.repositoriesExcluded.Load(),
+		TagsUnchanged:        r.tagsUnchanged.Load(),
+		TagsUpdated:          r.tagsUpdated.Load(),
+		TagsNew:              r.tagsNew.Load(),
+		TagsFailed:           r.tagsFailed.Load(),
+		TagsUntracked:        r.tagsUntracked.Load(),
+	}
+}
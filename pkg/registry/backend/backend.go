@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/seqeralabs/staticreg/pkg/cfg"
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/offline"
+	registryimpl "github.com/seqeralabs/staticreg/pkg/registry/registry"
+)
+
+// Backend is the set of raw operations staticreg reads upstream data with, whether the
+// data comes from a registry or from disk. Everything above it (the crawler, the catalog
+// sources, the CLI) only knows about this interface.
+type Backend interface {
+	// RepoPage returns at most n repositories after last, in lexical order
+	RepoPage(ctx context.Context, last string, n int) ([]string, error)
+	TagList(ctx context.Context, repo string) ([]string, error)
+	ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error)
+	// Digest returns the digest of the manifest a tag points to, it should be cheaper than ImageInfo
+	Digest(ctx context.Context, repo string, tag string) (string, error)
+	// Referrers returns the artifacts attached to the manifest with the given digest
+	Referrers(ctx context.Context, repo string, digest string) ([]registry.Referrer, error)
+}
+
+// Decorator adds behavior around every operation of a Backend
+type Decorator func(Backend) Backend
+
+// Chain wraps b with decorators, the first decorator is the outermost one
+func Chain(b Backend, decorators ...Decorator) Backend {
+	for i := len(decorators) - 1; i >= 0; i-- {
+		b = decorators[i](b)
+	}
+	return b
+}
+
+// New returns the backend of a registry: the registry itself, or the layouts
+// and tarballs on disk when the registry has an offline source
+func New(regCfg *cfg.Registry) (Backend, error) {
+	if regCfg.Source != "" {
+		if !offline.IsOffline(regCfg.Source) {
+			return nil, fmt.Errorf("%w: %q", offline.ErrInvalidSource, regCfg.Source)
+		}
+		return offline.New(regCfg.Source)
+	}
+	return registryimpl.New(regCfg)
+}
@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/backend/backendtest"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+)
+
+var _ Backend = (*backendtest.Fake)(nil)
+
+var errFlaky = errors.New("connection reset by peer")
+
+func newFake() *backendtest.Fake {
+	fake := backendtest.New()
+	fake.SetTag("library/app", "1.0", "sha256:aaaa")
+	fake.SetTag("library/app", "latest", "sha256:aaaa")
+	fake.SetTag("library/db", "2.0", "sha256:bbbb")
+	return fake
+}
+
+// newRetry returns a Retry decorator that does not wait between attempts
+func newRetry(next Backend, maxRetries int) Backend {
+	b := Retry(maxRetries)(next)
+	if rb, ok := b.(*retryBackend); ok {
+		rb.newBackOff = func() backoff.BackOff {
+			return &backoff.ZeroBackOff{}
+		}
+	}
+	return b
+}
+
+// recorder is a decorator appending its name to calls when TagList goes through it
+type recorder struct {
+	Backend
+	name  string
+	calls *[]string
+}
+
+func (r *recorder) TagList(ctx context.Context, repo string) ([]string, error) {
+	*r.calls = append(*r.calls, r.name)
+	return r.Backend.TagList(ctx, repo)
+}
+
+func record(name string, calls *[]string) Decorator {
+	return func(next Backend) Backend {
+		return &recorder{Backend: next, name: name, calls: calls}
+	}
+}
+
+func TestChain(t *testing.T) {
+	calls := []string{}
+	b := Chain(newFake(), record("outer", &calls), record("middle", &calls), record("inner", &calls))
+
+	tags, err := b.TagList(context.Background(), "library/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.0", "latest"}; !slices.Equal(tags, want) {
+		t.Errorf("got tags %v, want %v", tags, want)
+	}
+	if want := []string{"outer", "middle", "inner"}; !slices.Equal(calls, want) {
+		t.Errorf("decorators called in order %v, want %v", calls, want)
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "not found", err: fmt.Errorf("%w: tag", errs.ErrNotFound), want: true},
+		{name: "invalid reference", err: errs.ErrInvalidReference, want: true},
+		{name: "canceled", err: context.Canceled, want: true},
+		{name: "deadline", err: fmt.Errorf("fetching manifest: %w", context.DeadlineExceeded), want: false},
+		{name: "unauthorized", err: &transport.Error{StatusCode: http.StatusUnauthorized}, want: true},
+		{name: "forbidden", err: &transport.Error{StatusCode: http.StatusForbidden}, want: true},
+		{name: "missing manifest", err: &transport.Error{StatusCode: http.StatusNotFound}, want: true},
+		{name: "request timeout", err: &transport.Error{StatusCode: http.StatusRequestTimeout}, want: false},
+		{name: "too many requests", err: &transport.Error{StatusCode: http.StatusTooManyRequests}, want: false},
+		{name: "server error", err: &transport.Error{StatusCode: http.StatusBadGateway}, want: false},
+		{name: "network", err: errFlaky, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Errorf("IsPermanent(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("transient errors are retried", func(t *testing.T) {
+		fake := newFake()
+		fake.Fail(backendtest.OpTagList, errFlaky, 2)
+		tags, err := newRetry(fake, 2).TagList(context.Background(), "library/app")
+		if err != nil {
+			t.Fatalf("got %v, want the third attempt to succeed", err)
+		}
+		if len(tags) != 2 || fake.Calls(backendtest.OpTagList) != 3 {
+			t.Errorf("got tags %v after %d calls, want 2 tags after 3 calls", tags, fake.Calls(backendtest.OpTagList))
+		}
+	})
+
+	t.Run("attempts are bounded", func(t *testing.T) {
+		fake := newFake()
+		fake.Fail(backendtest.OpDigest, &transport.Error{StatusCode: http.StatusServiceUnavailable}, -1)
+		_, err := newRetry(fake, 2).Digest(context.Background(), "library/app", "1.0")
+		var terr *transport.Error
+		if !errors.As(err, &terr) || terr.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("got %v, want the last error", err)
+		}
+		if n := fake.Calls(backendtest.OpDigest); n != 3 {
+			t.Errorf("got %d calls, want 3", n)
+		}
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		fake := newFake()
+		_, err := newRetry(fake, 5).ImageInfo(context.Background(), "library/app", "missing")
+		if !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("got %v, want %v", err, errs.ErrNotFound)
+		}
+		fake.Fail(backendtest.OpTagList, &transport.Error{StatusCode: http.StatusUnauthorized}, -1)
+		if _, err := newRetry(fake, 5).TagList(context.Background(), "library/app"); err == nil {
+			t.Fatal("got no error, want unauthorized")
+		}
+		if n, m := fake.Calls(backendtest.OpImageInfo), fake.Calls(backendtest.OpTagList); n != 1 || m != 1 {
+			t.Errorf("got %d ImageInfo and %d TagList calls, want 1 of each", n, m)
+		}
+	})
+
+	t.Run("a canceled caller stops retrying", func(t *testing.T) {
+		fake := newFake()
+		fake.Fail(backendtest.OpRepoPage, errFlaky, -1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := newRetry(fake, 5).RepoPage(ctx, "", 10); err == nil {
+			t.Fatal("got no error")
+		}
+		if n := fake.Calls(backendtest.OpRepoPage); n > 1 {
+			t.Errorf("got %d calls, want at most 1", n)
+		}
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		fake := newFake()
+		if b := Retry(0)(fake); b != Backend(fake) {
+			t.Errorf("got %T, want the backend undecorated", b)
+		}
+	})
+}
+
+func TestCache(t *testing.T) {
+	fake := newFake()
+	now := time.Now()
+	b := Cache(time.Minute)(fake).(*cacheBackend)
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		info, err := b.ImageInfo(ctx, "library/app", "1.0")
+		if err != nil || info.Digest != "sha256:aaaa" {
+			t.Fatalf("got %+v, %v", info, err)
+		}
+	}
+	if n := fake.Calls(backendtest.OpImageInfo); n != 1 {
+		t.Errorf("got %d upstream calls, want the result to be cached", n)
+	}
+
+	// arguments are part of the key
+	if _, err := b.ImageInfo(ctx, "library/app", "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.Calls(backendtest.OpImageInfo); n != 2 {
+		t.Errorf("got %d upstream calls, want another tag to be fetched", n)
+	}
+
+	// entries expire
+	fake.SetTag("library/app", "1.0", "sha256:cccc")
+	now = now.Add(2 * time.Minute)
+	info, err := b.ImageInfo(ctx, "library/app", "1.0")
+	if err != nil || info.Digest != "sha256:cccc" {
+		t.Errorf("got %+v, %v, want the moved tag once the entry expired", info, err)
+	}
+
+	// errors are not cached
+	fake.Fail(backendtest.OpTagList, errFlaky, 1)
+	if _, err := b.TagList(ctx, "library/db"); !errors.Is(err, errFlaky) {
+		t.Fatalf("got %v, want %v", err, errFlaky)
+	}
+	tags, err := b.TagList(ctx, "library/db")
+	if err != nil || !slices.Equal(tags, []string{"2.0"}) {
+		t.Errorf("got %v, %v, want the call after a failure to reach upstream", tags, err)
+	}
+
+	if b := Cache(0)(fake); b != Backend(fake) {
+		t.Errorf("got %T, want the backend undecorated without a ttl", b)
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	ctx := context.Background()
+
+	fake := newFake()
+	failing := FaultInjection(1, 0)(fake)
+	if _, err := failing.TagList(ctx, "library/app"); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("got %v, want %v", err, ErrInjectedFault)
+	}
+	if _, err := failing.Referrers(ctx, "library/app", "sha256:aaaa"); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("got %v, want %v", err, ErrInjectedFault)
+	}
+	if n := fake.Calls(backendtest.OpTagList); n != 0 {
+		t.Errorf("got %d upstream calls, want failed calls not to reach upstream", n)
+	}
+	if IsPermanent(ErrInjectedFault) {
+		t.Error("injected faults must be transient")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	slow := FaultInjection(0, time.Hour)(fake)
+	if _, err := slow.ImageInfo(canceled, "library/app", "1.0"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the delay to stop when the caller gives up", err)
+	}
+
+	if b := FaultInjection(0, 0)(fake); b != Backend(fake) {
+		t.Errorf("got %T, want the backend undecorated", b)
+	}
+}
+
+func TestFakeReferrers(t *testing.T) {
+	fake := newFake()
+	sig := registry.Referrer{ArtifactType: "application/vnd.dev.cosign.artifact.sig.v1+json", Digest: "sha256:dddd"}
+	fake.SetReferrers("library/app", "sha256:aaaa", []registry.Referrer{sig})
+
+	referrers, err := Chain(fake, Retry(1)).Referrers(context.Background(), "library/app", "sha256:aaaa")
+	if err != nil || len(referrers) != 1 || referrers[0].Digest != sig.Digest {
+		t.Errorf("got %v, %v, want %v", referrers, err, sig)
+	}
+}
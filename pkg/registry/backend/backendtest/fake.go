@@ -0,0 +1,198 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package backendtest provides an in-memory backend for tests
+package backendtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+)
+
+// Operations of the backend, to count calls and inject failures with
+const (
+	OpRepoPage  = "RepoPage"
+	OpTagList   = "TagList"
+	OpImageInfo = "ImageInfo"
+	OpDigest    = "Digest"
+	OpReferrers = "Referrers"
+)
+
+// failure makes the next calls of an operation fail, forever when times is negative
+type failure struct {
+	err   error
+	times int
+}
+
+// Fake is an in-memory registry implementing backend.Backend, safe for concurrent use.
+// Missing repositories and tags are reported with errs.ErrNotFound, like real backends do.
+type Fake struct {
+	mu sync.Mutex
+	// repos maps each repository to the image info of its tags
+	repos     map[string]map[string]registry.ImageInfo
+	referrers map[string][]registry.Referrer
+	failures  map[string]*failure
+	calls     map[string]int
+}
+
+func New() *Fake {
+	return &Fake{
+		repos:     map[string]map[string]registry.ImageInfo{},
+		referrers: map[string][]registry.Referrer{},
+		failures:  map[string]*failure{},
+		calls:     map[string]int{},
+	}
+}
+
+// SetTag creates or moves a tag to a manifest with the given digest, creating the repository if needed
+func (f *Fake) SetTag(repo string, tag string, digest string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tags, ok := f.repos[repo]
+	if !ok {
+		tags = map[string]registry.ImageInfo{}
+		f.repos[repo] = tags
+	}
+	tags[tag] = registry.ImageInfo{
+		Reference: repo + ":" + tag,
+		Digest:    digest,
+		MediaType: "application/vnd.oci.image.manifest.v1+json",
+	}
+}
+
+// DeleteTag removes a tag, the repository is kept even when it has no tags left
+func (f *Fake) DeleteTag(repo string, tag string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.repos[repo], tag)
+}
+
+// DeleteRepository removes a repository and its tags
+func (f *Fake) DeleteRepository(repo string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.repos, repo)
+}
+
+// SetReferrers sets the artifacts attached to the manifest with the given digest
+func (f *Fake) SetReferrers(repo string, digest string, referrers []registry.Referrer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.referrers[repo+"@"+digest] = referrers
+}
+
+// Fail makes the next times calls of op fail with err, every call when times is negative
+func (f *Fake) Fail(op string, err error, times int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[op] = &failure{err: err, times: times}
+}
+
+// Calls returns how many times op was called, failed calls included
+func (f *Fake) Calls(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// call counts a call of op and returns the error it should fail with, f.mu must be held
+func (f *Fake) call(op string) error {
+	f.calls[op]++
+	fail, ok := f.failures[op]
+	if !ok {
+		return nil
+	}
+	if fail.times > 0 {
+		fail.times--
+		if fail.times == 0 {
+			delete(f.failures, op)
+		}
+	}
+	return fail.err
+}
+
+func (f *Fake) RepoPage(_ context.Context, last string, n int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(OpRepoPage); err != nil {
+		return nil, err
+	}
+	repos := make([]string, 0, len(f.repos))
+	for r := range f.repos {
+		if r > last {
+			repos = append(repos, r)
+		}
+	}
+	sort.Strings(repos)
+	return repos[:min(n, len(repos))], nil
+}
+
+func (f *Fake) TagList(_ context.Context, repo string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(OpTagList); err != nil {
+		return nil, err
+	}
+	tags, ok := f.repos[repo]
+	if !ok {
+		return nil, fmt.Errorf("%w: repository %s", errs.ErrNotFound, repo)
+	}
+	list := make([]string, 0, len(tags))
+	for t := range tags {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func (f *Fake) ImageInfo(_ context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(OpImageInfo); err != nil {
+		return registry.ImageInfo{}, err
+	}
+	info, ok := f.repos[repo][tag]
+	if !ok {
+		return registry.ImageInfo{}, fmt.Errorf("%w: tag %s:%s", errs.ErrNotFound, repo, tag)
+	}
+	return info, nil
+}
+
+func (f *Fake) Digest(_ context.Context, repo string, tag string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(OpDigest); err != nil {
+		return "", err
+	}
+	info, ok := f.repos[repo][tag]
+	if !ok {
+		return "", fmt.Errorf("%w: tag %s:%s", errs.ErrNotFound, repo, tag)
+	}
+	return info.Digest, nil
+}
+
+func (f *Fake) Referrers(_ context.Context, repo string, digest string) ([]registry.Referrer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(OpReferrers); err != nil {
+		return nil, err
+	}
+	return slices.Clone(f.referrers[repo+"@"+digest]), nil
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v3"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+type cacheKey struct {
+	op   string
+	args string
+}
+
+type cacheEntry struct {
+	value     any
+	expiresAt time.Time
+}
+
+type cacheBackend struct {
+	next    Backend
+	ttl     time.Duration
+	entries *xsync.MapOf[cacheKey, cacheEntry]
+	now     func() time.Time
+}
+
+// Cache keeps the successful results of every operation for ttl, errors are not cached.
+// It saves upstream requests when the same data is asked for repeatedly, e.g. by webhooks
+// and the periodic synchronization at the same time.
+func Cache(ttl time.Duration) Decorator {
+	return func(next Backend) Backend {
+		if ttl <= 0 {
+			return next
+		}
+		return &cacheBackend{
+			next:    next,
+			ttl:     ttl,
+			entries: xsync.NewMapOf[cacheKey, cacheEntry](),
+			now:     time.Now,
+		}
+	}
+}
+
+func (b *cacheBackend) RepoPage(ctx context.Context, last string, n int) ([]string, error) {
+	return cached(b, cacheKey{op: "RepoPage", args: last + "\x00" + strconv.Itoa(n)}, func() ([]string, error) {
+		return b.next.RepoPage(ctx, last, n)
+	})
+}
+
+func (b *cacheBackend) TagList(ctx context.Context, repo string) ([]string, error) {
+	return cached(b, cacheKey{op: "TagList", args: repo}, func() ([]string, error) {
+		return b.next.TagList(ctx, repo)
+	})
+}
+
+func (b *cacheBackend) ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	return cached(b, cacheKey{op: "ImageInfo", args: repo + ":" + tag}, func() (registry.ImageInfo, error) {
+		return b.next.ImageInfo(ctx, repo, tag)
+	})
+}
+
+func (b *cacheBackend) Digest(ctx context.Context, repo string, tag string) (string, error) {
+	return cached(b, cacheKey{op: "Digest", args: repo + ":" + tag}, func() (string, error) {
+		return b.next.Digest(ctx, repo, tag)
+	})
+}
+
+func (b *cacheBackend) Referrers(ctx context.Context, repo string, digest string) ([]registry.Referrer, error) {
+	return cached(b, cacheKey{op: "Referrers", args: repo + "@" + digest}, func() ([]registry.Referrer, error) {
+		return b.next.Referrers(ctx, repo, digest)
+	})
+}
+
+func cached[T any](b *cacheBackend, key cacheKey, load func() (T, error)) (T, error) {
+	if e, ok := b.entries.Load(key); ok && b.now().Before(e.expiresAt) {
+		return e.value.(T), nil
+	}
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	b.entries.Store(key, cacheEntry{value: v, expiresAt: b.now().Add(b.ttl)})
+	b.evictExpired()
+	return v, nil
+}
+
+// evictExpired drops expired entries once in a while so that the cache does not grow forever
+func (b *cacheBackend) evictExpired() {
+	if b.entries.Size()%1024 != 0 {
+		return
+	}
+	now := b.now()
+	b.entries.Range(func(k cacheKey, e cacheEntry) bool {
+		if now.After(e.expiresAt) {
+			b.entries.Delete(k)
+		}
+		return true
+	})
+}
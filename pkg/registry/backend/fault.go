@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+var ErrInjectedFault = errors.New("injected fault")
+
+type faultBackend struct {
+	next    Backend
+	rate    float64
+	latency time.Duration
+}
+
+// FaultInjection makes a rate (0 to 1) of operations fail with ErrInjectedFault and delays
+// every operation by up to latency. It is meant to check how staticreg copes with a flaky upstream.
+func FaultInjection(rate float64, latency time.Duration) Decorator {
+	return func(next Backend) Backend {
+		if rate <= 0 && latency <= 0 {
+			return next
+		}
+		return &faultBackend{
+			next:    next,
+			rate:    rate,
+			latency: latency,
+		}
+	}
+}
+
+func (b *faultBackend) RepoPage(ctx context.Context, last string, n int) ([]string, error) {
+	if err := b.inject(ctx); err != nil {
+		return nil, err
+	}
+	return b.next.RepoPage(ctx, last, n)
+}
+
+func (b *faultBackend) TagList(ctx context.Context, repo string) ([]string, error) {
+	if err := b.inject(ctx); err != nil {
+		return nil, err
+	}
+	return b.next.TagList(ctx, repo)
+}
+
+func (b *faultBackend) ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	if err := b.inject(ctx); err != nil {
+		return registry.ImageInfo{}, err
+	}
+	return b.next.ImageInfo(ctx, repo, tag)
+}
+
+func (b *faultBackend) Digest(ctx context.Context, repo string, tag string) (string, error) {
+	if err := b.inject(ctx); err != nil {
+		return "", err
+	}
+	return b.next.Digest(ctx, repo, tag)
+}
+
+func (b *faultBackend) Referrers(ctx context.Context, repo string, digest string) ([]registry.Referrer, error) {
+	if err := b.inject(ctx); err != nil {
+		return nil, err
+	}
+	return b.next.Referrers(ctx, repo, digest)
+}
+
+func (b *faultBackend) inject(ctx context.Context) error {
+	if b.latency > 0 {
+		select {
+		case <-time.After(rand.N(b.latency)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if rand.Float64() < b.rate {
+		return ErrInjectedFault
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+type loggingBackend struct {
+	next Backend
+}
+
+// Logging logs every operation at debug level along with its duration and outcome
+func Logging() Decorator {
+	return func(next Backend) Backend {
+		return &loggingBackend{
+			next: next,
+		}
+	}
+}
+
+func (b *loggingBackend) RepoPage(ctx context.Context, last string, n int) ([]string, error) {
+	start := time.Now()
+	repos, err := b.next.RepoPage(ctx, last, n)
+	logCall(ctx, "RepoPage", start, err, slog.String("last", last), slog.Int("n", n))
+	return repos, err
+}
+
+func (b *loggingBackend) TagList(ctx context.Context, repo string) ([]string, error) {
+	start := time.Now()
+	tags, err := b.next.TagList(ctx, repo)
+	logCall(ctx, "TagList", start, err, slog.String("repo", repo))
+	return tags, err
+}
+
+func (b *loggingBackend) ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	start := time.Now()
+	info, err := b.next.ImageInfo(ctx, repo, tag)
+	logCall(ctx, "ImageInfo", start, err, slog.String("repo", repo), slog.String("tag", tag))
+	return info, err
+}
+
+func (b *loggingBackend) Digest(ctx context.Context, repo string, tag string) (string, error) {
+	start := time.Now()
+	digest, err := b.next.Digest(ctx, repo, tag)
+	logCall(ctx, "Digest", start, err, slog.String("repo", repo), slog.String("tag", tag))
+	return digest, err
+}
+
+func (b *loggingBackend) Referrers(ctx context.Context, repo string, digest string) ([]registry.Referrer, error) {
+	start := time.Now()
+	referrers, err := b.next.Referrers(ctx, repo, digest)
+	logCall(ctx, "Referrers", start, err, slog.String("repo", repo), slog.String("digest", digest))
+	return referrers, err
+}
+
+func logCall(ctx context.Context, op string, start time.Time, err error, attrs ...any) {
+	log := logger.FromContext(ctx)
+	if log == nil {
+		return
+	}
+	attrs = append(attrs, slog.String("op", op), slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		attrs = append(attrs, logger.ErrAttr(err))
+	}
+	log.Debug("backend call", attrs...)
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+// metricsVar is the expvar under which the metrics of every backend are published, by backend name
+const metricsVar = "backend"
+
+var (
+	metricsRoot     *expvar.Map
+	metricsRootOnce sync.Once
+)
+
+type metricsBackend struct {
+	next    Backend
+	metrics *expvar.Map
+}
+
+// Metrics counts the calls, errors and total duration of each operation. They are published
+// with expvar, under backend.<name>.<operation>.{calls,errors,duration_ms}.
+func Metrics(name string) Decorator {
+	return func(next Backend) Backend {
+		metricsRootOnce.Do(func() {
+			metricsRoot = expvar.NewMap(metricsVar)
+		})
+		m, ok := metricsRoot.Get(name).(*expvar.Map)
+		if !ok {
+			m = new(expvar.Map).Init()
+			metricsRoot.Set(name, m)
+		}
+		return &metricsBackend{
+			next:    next,
+			metrics: m,
+		}
+	}
+}
+
+func (b *metricsBackend) RepoPage(ctx context.Context, last string, n int) ([]string, error) {
+	start := time.Now()
+	repos, err := b.next.RepoPage(ctx, last, n)
+	b.record("RepoPage", start, err)
+	return repos, err
+}
+
+func (b *metricsBackend) TagList(ctx context.Context, repo string) ([]string, error) {
+	start := time.Now()
+	tags, err := b.next.TagList(ctx, repo)
+	b.record("TagList", start, err)
+	return tags, err
+}
+
+func (b *metricsBackend) ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	start := time.Now()
+	info, err := b.next.ImageInfo(ctx, repo, tag)
+	b.record("ImageInfo", start, err)
+	return info, err
+}
+
+func (b *metricsBackend) Digest(ctx context.Context, repo string, tag string) (string, error) {
+	start := time.Now()
+	digest, err := b.next.Digest(ctx, repo, tag)
+	b.record("Digest", start, err)
+	return digest, err
+}
+
+func (b *metricsBackend) Referrers(ctx context.Context, repo string, digest string) ([]registry.Referrer, error) {
+	start := time.Now()
+	referrers, err := b.next.Referrers(ctx, repo, digest)
+	b.record("Referrers", start, err)
+	return referrers, err
+}
+
+func (b *metricsBackend) record(op string, start time.Time, err error) {
+	b.metrics.Add(op+".calls", 1)
+	b.metrics.Add(op+".duration_ms", time.Since(start).Milliseconds())
+	if err != nil {
+		b.metrics.Add(op+".errors", 1)
+	}
+}
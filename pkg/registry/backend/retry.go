@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+)
+
+type retryBackend struct {
+	next       Backend
+	maxRetries uint64
+	newBackOff func() backoff.BackOff
+}
+
+// Retry retries failed operations up to maxRetries times with an exponential backoff.
+// Errors that will not go away by retrying, like a missing tag or a denied access, are returned right away.
+// The crawler retries failed repositories and tags on its own, this is for one-off commands
+// like preview-filters that have nothing else to fall back on.
+func Retry(maxRetries int) Decorator {
+	return func(next Backend) Backend {
+		if maxRetries <= 0 {
+			return next
+		}
+		return &retryBackend{
+			next:       next,
+			maxRetries: uint64(maxRetries),
+			newBackOff: func() backoff.BackOff {
+				bo := backoff.NewExponentialBackOff()
+				bo.InitialInterval = 500 * time.Millisecond
+				bo.MaxInterval = 10 * time.Second
+				return bo
+			},
+		}
+	}
+}
+
+func (b *retryBackend) RepoPage(ctx context.Context, last string, n int) ([]string, error) {
+	return retry(ctx, b, func() ([]string, error) {
+		return b.next.RepoPage(ctx, last, n)
+	})
+}
+
+func (b *retryBackend) TagList(ctx context.Context, repo string) ([]string, error) {
+	return retry(ctx, b, func() ([]string, error) {
+		return b.next.TagList(ctx, repo)
+	})
+}
+
+func (b *retryBackend) ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	return retry(ctx, b, func() (registry.ImageInfo, error) {
+		return b.next.ImageInfo(ctx, repo, tag)
+	})
+}
+
+func (b *retryBackend) Digest(ctx context.Context, repo string, tag string) (string, error) {
+	return retry(ctx, b, func() (string, error) {
+		return b.next.Digest(ctx, repo, tag)
+	})
+}
+
+func (b *retryBackend) Referrers(ctx context.Context, repo string, digest string) ([]registry.Referrer, error) {
+	return retry(ctx, b, func() ([]registry.Referrer, error) {
+		return b.next.Referrers(ctx, repo, digest)
+	})
+}
+
+func retry[T any](ctx context.Context, b *retryBackend, op func() (T, error)) (T, error) {
+	bo := backoff.WithContext(backoff.WithMaxRetries(b.newBackOff(), b.maxRetries), ctx)
+	return backoff.RetryWithData(func() (T, error) {
+		v, err := op()
+		if err != nil && IsPermanent(err) {
+			return v, backoff.Permanent(err)
+		}
+		return v, err
+	}, bo)
+}
+
+// IsPermanent tells if err will not go away by trying again.
+// A deadline is not permanent, a slow call can succeed the next time: retrying stops
+// anyway once the context of the caller is done.
+func IsPermanent(err error) bool {
+	if errors.Is(err, errs.ErrNotFound) || errors.Is(err, errs.ErrInvalidReference) ||
+		errors.Is(err, context.Canceled) {
+		return true
+	}
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		switch terr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return false
+		}
+		return terr.StatusCode >= 400 && terr.StatusCode < 500
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 100
+	// apiTimeout bounds every request made to vendor listing APIs
+	apiTimeout = 30 * time.Second
+	userAgent  = "seqera/staticreg"
+	// endCursor is returned with the last page of sources that can't tell where they stopped otherwise
+	endCursor = "end"
+)
+
+var (
+	ErrInvalidSource = errors.New("invalid catalog source")
+	ErrInvalidCursor = errors.New("invalid catalog cursor")
+	ErrListing       = errors.New("listing repositories failed")
+)
+
+// PageFunc receives a page of repository names and the cursor that resumes the walk right after that page
+type PageFunc func(repos []string, cursor string) error
+
+// Source lists the repositories of a registry
+type Source interface {
+	// Walk lists the repositories page by page calling fn for each page.
+	// When cursor is not empty the walk resumes right after the page that cursor was returned with.
+	Walk(ctx context.Context, cursor string, fn PageFunc) error
+}
+
+// Pager retrieves pages of the registry /v2/_catalog endpoint
+type Pager interface {
+	// RepoPage retrieves at most n repository names, starting right after the repository named last
+	RepoPage(ctx context.Context, last string, n int) ([]string, error)
+}
+
+// Config describes where the list of repositories of a registry comes from.
+//
+// Spec is one of:
+//   - "" or "catalog": the registry /v2/_catalog endpoint
+//   - "file:<path>": a file with one repository per line, re-read when it changes
+//   - "glob:<pattern>[,<pattern>...]": repositories matching the patterns, expanded using the catalog
+//   - "dockerhub:<namespace>[,<namespace>...]": the Docker Hub repositories listing API
+//   - "github:[orgs/|users/]<owner>[,...]": the GitHub packages API, defaults to organizations
+type Config struct {
+	Spec string
+	// APIURL overrides the base URL of vendor listing APIs
+	APIURL string
+	// User and Password authenticate against vendor listing APIs,
+	// for GitHub the password is a token with the read:packages scope
+	User     string
+	Password string
+	PageSize int
+}
+
+// New creates the Source described by cfg, pager is used by the sources relying on the registry catalog
+func New(cfg Config, pager Pager) (Source, error) {
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = defaultPageSize
+	}
+
+	kind, arg, _ := strings.Cut(cfg.Spec, ":")
+	switch kind {
+	case "", "catalog":
+		return NewRegistrySource(pager, cfg.PageSize), nil
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("%w: missing file path in %q", ErrInvalidSource, cfg.Spec)
+		}
+		return NewFileSource(arg, cfg.PageSize), nil
+	case "glob":
+		patterns := splitList(arg)
+		if len(patterns) == 0 {
+			return nil, fmt.Errorf("%w: missing patterns in %q", ErrInvalidSource, cfg.Spec)
+		}
+		sources := make([]Source, 0, len(patterns))
+		for _, p := range patterns {
+			sources = append(sources, NewPatternSource(pager, p, cfg.PageSize))
+		}
+		return NewMultiSource(sources...), nil
+	case "dockerhub":
+		namespaces := splitList(arg)
+		if len(namespaces) == 0 {
+			return nil, fmt.Errorf("%w: missing namespaces in %q", ErrInvalidSource, cfg.Spec)
+		}
+		baseURL := cfg.APIURL
+		if baseURL == "" {
+			baseURL = defaultDockerHubURL
+		}
+		sources := make([]Source, 0, len(namespaces))
+		for _, ns := range namespaces {
+			sources = append(sources, NewDockerHubSource(newHTTPClient(), baseURL, ns, cfg.User, cfg.Password, cfg.PageSize))
+		}
+		return NewMultiSource(sources...), nil
+	case "github":
+		owners := splitList(arg)
+		if len(owners) == 0 {
+			return nil, fmt.Errorf("%w: missing owners in %q", ErrInvalidSource, cfg.Spec)
+		}
+		baseURL := cfg.APIURL
+		if baseURL == "" {
+			baseURL = defaultGitHubURL
+		}
+		sources := make([]Source, 0, len(owners))
+		for _, o := range owners {
+			ownerKind, owner, ok := strings.Cut(o, "/")
+			if !ok {
+				ownerKind, owner = "orgs", o
+			}
+			if ownerKind != "orgs" && ownerKind != "users" {
+				return nil, fmt.Errorf("%w: unknown GitHub owner kind %q", ErrInvalidSource, ownerKind)
+			}
+			sources = append(sources, NewGitHubSource(newHTTPClient(), baseURL, ownerKind, owner, cfg.Password, cfg.PageSize))
+		}
+		return NewMultiSource(sources...), nil
+	}
+	return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidSource, kind)
+}
+
+type registrySource struct {
+	pager    Pager
+	pageSize int
+}
+
+// NewRegistrySource walks the registry /v2/_catalog endpoint using the last/n pagination
+func NewRegistrySource(pager Pager, pageSize int) Source {
+	return &registrySource{
+		pager:    pager,
+		pageSize: pageSize,
+	}
+}
+
+func (s *registrySource) Walk(ctx context.Context, cursor string, fn PageFunc) error {
+	for {
+		repos, err := s.pager.RepoPage(ctx, cursor, s.pageSize)
+		if err != nil {
+			return err
+		}
+		if len(repos) == 0 {
+			return nil
+		}
+		last := repos[len(repos)-1]
+		if last == cursor {
+			// the registry ignores the last parameter and keeps returning the same page
+			return nil
+		}
+		if err := fn(repos, last); err != nil {
+			return err
+		}
+		// a short page does not mean the end of the catalog, registries cap the page size
+		// on their side (1000 for distribution), only an empty page does
+		cursor = last
+	}
+}
+
+type multiSource struct {
+	sources []Source
+}
+
+// NewMultiSource walks each of sources one after the other
+func NewMultiSource(sources ...Source) Source {
+	if len(sources) == 1 {
+		return sources[0]
+	}
+	return &multiSource{
+		sources: sources,
+	}
+}
+
+// Walk prefixes the cursors of the underlying sources with their index, e.g. "2:<cursor>"
+func (s *multiSource) Walk(ctx context.Context, cursor string, fn PageFunc) error {
+	start, inner := 0, ""
+	if cursor != "" {
+		idx, rest, ok := strings.Cut(cursor, ":")
+		i, err := strconv.Atoi(idx)
+		if !ok || err != nil || i < 0 || i >= len(s.sources) {
+			return fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+		}
+		start, inner = i, rest
+	}
+
+	for i := start; i < len(s.sources); i++ {
+		err := s.sources[i].Walk(ctx, inner, func(repos []string, cursor string) error {
+			return fn(repos, fmt.Sprintf("%d:%s", i, cursor))
+		})
+		if err != nil {
+			return err
+		}
+		inner = ""
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getJSON performs a GET request against a listing API and decodes the JSON response into out
+func getJSON(ctx context.Context, client *http.Client, u string, headers http.Header, out any) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %s", ErrListing, req.URL.Host, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("%w: decoding response from %s: %w", ErrListing, req.URL.Host, err)
+	}
+	return resp.Header, nil
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: apiTimeout,
+	}
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// cappedPager serves a sorted catalog like distribution does, returning at most limit
+// repositories per page whatever the client asks for
+type cappedPager struct {
+	repos []string
+	limit int
+	calls int
+}
+
+func (p *cappedPager) RepoPage(_ context.Context, last string, n int) ([]string, error) {
+	p.calls++
+	n = min(n, p.limit)
+	i := sort.SearchStrings(p.repos, last)
+	if i < len(p.repos) && p.repos[i] == last {
+		i++
+	}
+	return slices.Clone(p.repos[i:min(i+n, len(p.repos))]), nil
+}
+
+func newCappedPager(n int, limit int) *cappedPager {
+	repos := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		repos = append(repos, fmt.Sprintf("team-%d/app-%04d", i%3, i))
+	}
+	sort.Strings(repos)
+	return &cappedPager{repos: repos, limit: limit}
+}
+
+func walkAll(t *testing.T, s Source, cursor string) ([]string, []string) {
+	t.Helper()
+	repos, cursors := []string{}, []string{}
+	err := s.Walk(context.Background(), cursor, func(page []string, cursor string) error {
+		repos = append(repos, page...)
+		cursors = append(cursors, cursor)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking the catalog: %v", err)
+	}
+	return repos, cursors
+}
+
+func TestRegistrySourceWalksPastServerPageCap(t *testing.T) {
+	pager := newCappedPager(2500, 1000)
+	repos, cursors := walkAll(t, NewRegistrySource(pager, 5000), "")
+	if !slices.Equal(repos, pager.repos) {
+		t.Fatalf("got %d repositories, want all %d", len(repos), len(pager.repos))
+	}
+	if len(cursors) != 3 {
+		t.Errorf("got %d pages, want 3", len(cursors))
+	}
+
+	resumed, _ := walkAll(t, NewRegistrySource(pager, 5000), cursors[0])
+	if !slices.Equal(resumed, pager.repos[1000:]) {
+		t.Errorf("resuming from %q got %d repositories, want %d", cursors[0], len(resumed), len(pager.repos)-1000)
+	}
+}
+
+func TestRegistrySourceEmptyCatalog(t *testing.T) {
+	repos, _ := walkAll(t, NewRegistrySource(newCappedPager(0, 1000), 100), "")
+	if len(repos) != 0 {
+		t.Fatalf("got %v, want no repositories", repos)
+	}
+}
+
+func TestPatternSourceWalksPastServerPageCap(t *testing.T) {
+	pager := newCappedPager(2500, 100)
+	repos, _ := walkAll(t, NewPatternSource(pager, "team-1/*", 1000), "")
+
+	want := []string{}
+	for _, r := range pager.repos {
+		if len(r) > 7 && r[:7] == "team-1/" {
+			want = append(want, r)
+		}
+	}
+	if !slices.Equal(repos, want) {
+		t.Fatalf("got %d repositories, want %d", len(repos), len(want))
+	}
+}
+
+func TestPatternSourceListsThePrefix(t *testing.T) {
+	pager := &cappedPager{
+		repos: []string{"team-", "team-`x", "team-a", "team-a/app", "team-ab", "team-b"},
+		limit: 2,
+	}
+	tests := map[string][]string{
+		"team-a*":  {"team-a", "team-ab"},
+		"team-a/*": {"team-a/app"},
+		"team-*":   {"team-", "team-`x", "team-a", "team-ab", "team-b"},
+		"*":        {"team-", "team-`x", "team-a", "team-ab", "team-b"},
+	}
+	for pattern, want := range tests {
+		repos, _ := walkAll(t, NewPatternSource(pager, pattern, 2), "")
+		if !slices.Equal(repos, want) {
+			t.Errorf("%s: got %v, want %v", pattern, repos, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const defaultDockerHubURL = "https://hub.docker.com"
+
+type dockerHubSource struct {
+	client    *http.Client
+	baseURL   string
+	namespace string
+	user      string
+	password  string
+	pageSize  int
+}
+
+type dockerHubPage struct {
+	Next    string `json:"next"`
+	Results []struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"results"`
+}
+
+// NewDockerHubSource lists the repositories of a Docker Hub namespace using the Hub API.
+// Private repositories are included when user and password (or a personal access token) are provided.
+func NewDockerHubSource(client *http.Client, baseURL string, namespace string, user string, password string, pageSize int) Source {
+	return &dockerHubSource{
+		client:    client,
+		baseURL:   baseURL,
+		namespace: namespace,
+		user:      user,
+		password:  password,
+		pageSize:  pageSize,
+	}
+}
+
+// Walk uses the URL of the next page as cursor
+func (s *dockerHubSource) Walk(ctx context.Context, cursor string, fn PageFunc) error {
+	if cursor == endCursor {
+		return nil
+	}
+
+	headers := http.Header{}
+	if s.user != "" && s.password != "" {
+		token, err := s.login(ctx)
+		if err != nil {
+			return err
+		}
+		headers.Set("Authorization", "Bearer "+token)
+	}
+
+	next := cursor
+	if next == "" {
+		next = fmt.Sprintf("%s/v2/namespaces/%s/repositories?page_size=%d", s.baseURL, url.PathEscape(s.namespace), s.pageSize)
+	}
+
+	for next != "" {
+		var page dockerHubPage
+		if _, err := getJSON(ctx, s.client, next, headers, &page); err != nil {
+			return err
+		}
+
+		repos := make([]string, 0, len(page.Results))
+		for _, r := range page.Results {
+			ns := r.Namespace
+			if ns == "" {
+				ns = s.namespace
+			}
+			repos = append(repos, ns+"/"+r.Name)
+		}
+
+		next = page.Next
+		cursor := next
+		if cursor == "" {
+			cursor = endCursor
+		}
+		if len(repos) > 0 {
+			if err := fn(repos, cursor); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *dockerHubSource) login(ctx context.Context) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"username": s.user,
+		"password": s.password,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/v2/users/login", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: Docker Hub login returned %s", ErrListing, resp.Status)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", err
+	}
+	return login.Token, nil
+}
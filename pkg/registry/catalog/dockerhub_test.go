@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// newDockerHubStandIn serves the repositories of the seqeralabs namespace through a Docker Hub like API,
+// private repositories are only listed for requests carrying the token returned by the login endpoint
+func newDockerHubStandIn(t *testing.T, public []string, private []string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("POST /v2/users/login", func(w http.ResponseWriter, r *http.Request) {
+		var creds struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil || creds.Username != "bot" || creds.Password != "pat" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "hub-token"})
+	})
+	mux.HandleFunc("GET /v2/namespaces/{namespace}/repositories", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("namespace") != "seqeralabs" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		repos := public
+		switch r.Header.Get("Authorization") {
+		case "":
+		case "Bearer hub-token":
+			repos = append(slices.Clone(public), private...)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		size, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		start, end := min((page-1)*size, len(repos)), min(page*size, len(repos))
+
+		results := []map[string]string{}
+		for _, name := range repos[start:end] {
+			results = append(results, map[string]string{"name": name, "namespace": "seqeralabs"})
+		}
+		body := map[string]any{"next": nil, "results": results}
+		if end < len(repos) {
+			body["next"] = fmt.Sprintf("%s%s?page_size=%d&page=%d", srv.URL, r.URL.Path, size, page+1)
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	})
+	return srv
+}
+
+func TestDockerHubSourcePagination(t *testing.T) {
+	srv := newDockerHubStandIn(t, []string{"a", "b", "c", "d", "e"}, nil)
+	repos, cursors := walkAll(t, NewDockerHubSource(srv.Client(), srv.URL, "seqeralabs", "", "", 2), "")
+
+	want := []string{"seqeralabs/a", "seqeralabs/b", "seqeralabs/c", "seqeralabs/d", "seqeralabs/e"}
+	if !slices.Equal(repos, want) {
+		t.Fatalf("got %v, want %v", repos, want)
+	}
+	if len(cursors) != 3 || cursors[2] != endCursor {
+		t.Fatalf("got cursors %v, want 3 pages ending with %q", cursors, endCursor)
+	}
+
+	resumed, _ := walkAll(t, NewDockerHubSource(srv.Client(), srv.URL, "seqeralabs", "", "", 2), cursors[0])
+	if !slices.Equal(resumed, want[2:]) {
+		t.Errorf("resuming got %v, want %v", resumed, want[2:])
+	}
+	done, _ := walkAll(t, NewDockerHubSource(srv.Client(), srv.URL, "seqeralabs", "", "", 2), endCursor)
+	if len(done) != 0 {
+		t.Errorf("resuming a finished walk got %v, want nothing", done)
+	}
+}
+
+func TestDockerHubSourceAuth(t *testing.T) {
+	srv := newDockerHubStandIn(t, []string{"public"}, []string{"private"})
+
+	repos, _ := walkAll(t, NewDockerHubSource(srv.Client(), srv.URL, "seqeralabs", "bot", "pat", 10), "")
+	if want := []string{"seqeralabs/public", "seqeralabs/private"}; !slices.Equal(repos, want) {
+		t.Fatalf("got %v, want %v", repos, want)
+	}
+
+	repos, _ = walkAll(t, NewDockerHubSource(srv.Client(), srv.URL, "seqeralabs", "", "", 10), "")
+	if want := []string{"seqeralabs/public"}; !slices.Equal(repos, want) {
+		t.Fatalf("anonymously got %v, want %v", repos, want)
+	}
+}
+
+func TestDockerHubSourceErrors(t *testing.T) {
+	srv := newDockerHubStandIn(t, []string{"a"}, nil)
+
+	tests := []struct {
+		name      string
+		namespace string
+		user      string
+		password  string
+	}{
+		{name: "failed login", namespace: "seqeralabs", user: "bot", password: "wrong"},
+		{name: "missing namespace", namespace: "nobody"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewDockerHubSource(srv.Client(), srv.URL, tt.namespace, tt.user, tt.password, 10)
+			err := s.Walk(context.Background(), "", func([]string, string) error {
+				t.Fatal("got a page, want an error")
+				return nil
+			})
+			if !errors.Is(err, ErrListing) {
+				t.Fatalf("got %v, want %v", err, ErrListing)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fileSource struct {
+	path     string
+	pageSize int
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	repos   []string
+}
+
+// NewFileSource lists the repositories found in a file, one per line.
+// Empty lines and lines starting with # are ignored. The file is read
+// again whenever its size or modification time change.
+func NewFileSource(path string, pageSize int) Source {
+	return &fileSource{
+		path:     path,
+		pageSize: pageSize,
+	}
+}
+
+func (s *fileSource) Walk(ctx context.Context, cursor string, fn PageFunc) error {
+	repos, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	// repos are sorted, resume right after the cursor
+	start := 0
+	if cursor != "" {
+		start = sort.SearchStrings(repos, cursor)
+		if start < len(repos) && repos[start] == cursor {
+			start++
+		}
+	}
+
+	for i := start; i < len(repos); i += s.pageSize {
+		end := min(i+s.pageSize, len(repos))
+		page := repos[i:end]
+		if err := fn(page, page[len(page)-1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSource) load() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.repos != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.repos, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]struct{}{}
+	repos := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, ok := seen[line]; ok {
+			continue
+		}
+		seen[line] = struct{}{}
+		repos = append(repos, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(repos)
+
+	s.repos = repos
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return repos, nil
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultGitHubURL = "https://api.github.com"
+
+type gitHubSource struct {
+	client    *http.Client
+	baseURL   string
+	ownerKind string
+	owner     string
+	token     string
+	pageSize  int
+}
+
+type gitHubPackage struct {
+	Name  string `json:"name"`
+	Owner struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+// NewGitHubSource lists the container packages of a GitHub organization (ownerKind "orgs")
+// or user (ownerKind "users") as GHCR repositories.
+func NewGitHubSource(client *http.Client, baseURL string, ownerKind string, owner string, token string, pageSize int) Source {
+	return &gitHubSource{
+		client:    client,
+		baseURL:   baseURL,
+		ownerKind: ownerKind,
+		owner:     owner,
+		token:     token,
+		pageSize:  pageSize,
+	}
+}
+
+// Walk uses the URL of the next page, taken from the Link header, as cursor
+func (s *gitHubSource) Walk(ctx context.Context, cursor string, fn PageFunc) error {
+	if cursor == endCursor {
+		return nil
+	}
+
+	headers := http.Header{}
+	headers.Set("Accept", "application/vnd.github+json")
+	headers.Set("X-GitHub-Api-Version", "2022-11-28")
+	if s.token != "" {
+		headers.Set("Authorization", "Bearer "+s.token)
+	}
+
+	next := cursor
+	if next == "" {
+		next = fmt.Sprintf("%s/%s/%s/packages?package_type=container&per_page=%d", s.baseURL, s.ownerKind, url.PathEscape(s.owner), s.pageSize)
+	}
+
+	for next != "" {
+		var packages []gitHubPackage
+		respHeaders, err := getJSON(ctx, s.client, next, headers, &packages)
+		if err != nil {
+			return err
+		}
+
+		repos := make([]string, 0, len(packages))
+		for _, p := range packages {
+			owner := p.Owner.Login
+			if owner == "" {
+				owner = s.owner
+			}
+			// GHCR repository names are always lowercase
+			repos = append(repos, strings.ToLower(owner+"/"+p.Name))
+		}
+
+		next = nextLink(respHeaders.Values("Link"))
+		cursor := next
+		if cursor == "" {
+			cursor = endCursor
+		}
+		if len(repos) > 0 {
+			if err := fn(repos, cursor); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nextLink returns the URL with rel="next" in RFC 8288 Link headers
+func nextLink(headers []string) string {
+	for _, h := range headers {
+		for _, link := range strings.Split(h, ",") {
+			target, params, ok := strings.Cut(link, ";")
+			if !ok {
+				continue
+			}
+			for _, p := range strings.Split(params, ";") {
+				if strings.TrimSpace(p) == `rel="next"` {
+					return strings.Trim(strings.TrimSpace(target), "<>")
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// newGitHubStandIn serves the container packages of the Seqeralabs organization and of the octocat user
+// through a GitHub like API paginated with Link headers, every request must carry the gh-token token
+func newGitHubStandIn(t *testing.T, packages []string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("GET /{kind}/{owner}/packages", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		owner := r.PathValue("owner")
+		if kind := r.PathValue("kind"); (kind != "orgs" || owner != "Seqeralabs") && (kind != "users" || owner != "octocat") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("package_type") != "container" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		size, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		start, end := min((page-1)*size, len(packages)), min(page*size, len(packages))
+		if end < len(packages) {
+			next := fmt.Sprintf("%s%s?package_type=container&per_page=%d&page=%d", srv.URL, r.URL.Path, size, page+1)
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next", <%s?page=1>; rel="first"`, next, srv.URL+r.URL.Path))
+		}
+
+		body := []map[string]any{}
+		for _, name := range packages[start:end] {
+			body = append(body, map[string]any{"name": name, "owner": map[string]string{"login": owner}})
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	})
+	return srv
+}
+
+func TestGitHubSourcePagination(t *testing.T) {
+	srv := newGitHubStandIn(t, []string{"Nextflow", "wave", "fusion"})
+	repos, cursors := walkAll(t, NewGitHubSource(srv.Client(), srv.URL, "orgs", "Seqeralabs", "gh-token", 2), "")
+
+	want := []string{"seqeralabs/nextflow", "seqeralabs/wave", "seqeralabs/fusion"}
+	if !slices.Equal(repos, want) {
+		t.Fatalf("got %v, want %v", repos, want)
+	}
+	if len(cursors) != 2 || cursors[1] != endCursor {
+		t.Fatalf("got cursors %v, want 2 pages ending with %q", cursors, endCursor)
+	}
+
+	resumed, _ := walkAll(t, NewGitHubSource(srv.Client(), srv.URL, "orgs", "Seqeralabs", "gh-token", 2), cursors[0])
+	if !slices.Equal(resumed, want[2:]) {
+		t.Errorf("resuming got %v, want %v", resumed, want[2:])
+	}
+}
+
+func TestGitHubSourceUser(t *testing.T) {
+	srv := newGitHubStandIn(t, []string{"hello"})
+	repos, _ := walkAll(t, NewGitHubSource(srv.Client(), srv.URL, "users", "octocat", "gh-token", 10), "")
+	if want := []string{"octocat/hello"}; !slices.Equal(repos, want) {
+		t.Fatalf("got %v, want %v", repos, want)
+	}
+}
+
+func TestGitHubSourceErrors(t *testing.T) {
+	srv := newGitHubStandIn(t, []string{"wave"})
+
+	tests := []struct {
+		name  string
+		owner string
+		token string
+	}{
+		{name: "missing token", owner: "Seqeralabs"},
+		{name: "wrong token", owner: "Seqeralabs", token: "expired"},
+		{name: "missing organization", owner: "nobody", token: "gh-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewGitHubSource(srv.Client(), srv.URL, "orgs", tt.owner, tt.token, 10)
+			err := s.Walk(context.Background(), "", func([]string, string) error {
+				t.Fatal("got a page, want an error")
+				return nil
+			})
+			if !errors.Is(err, ErrListing) {
+				t.Fatalf("got %v, want %v", err, ErrListing)
+			}
+		})
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct {
+		headers []string
+		want    string
+	}{
+		{headers: nil, want: ""},
+		{headers: []string{`<https://api.github.com/orgs/x/packages?page=2>; rel="next", <https://api.github.com/orgs/x/packages?page=5>; rel="last"`}, want: "https://api.github.com/orgs/x/packages?page=2"},
+		{headers: []string{`<https://api.github.com/orgs/x/packages?page=1>; rel="prev"`}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := nextLink(tt.headers); got != tt.want {
+			t.Errorf("nextLink(%q) = %q, want %q", tt.headers, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package catalog
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// globMeta are the characters with a special meaning in path.Match patterns
+const globMeta = `*?[\`
+
+type patternSource struct {
+	pager    Pager
+	pattern  string
+	prefix   string
+	pageSize int
+}
+
+// NewPatternSource lists the repositories matching a path.Match pattern, e.g. "team-a/*".
+// The catalog is walked starting from the literal prefix of the pattern and stops as soon
+// as names no longer share it, so only a small part of a big catalog is read.
+// A pattern without wildcards is returned as is without querying the registry at all.
+func NewPatternSource(pager Pager, pattern string, pageSize int) Source {
+	prefix := pattern
+	if i := strings.IndexAny(pattern, globMeta); i >= 0 {
+		prefix = pattern[:i]
+	}
+	return &patternSource{
+		pager:    pager,
+		pattern:  pattern,
+		prefix:   prefix,
+		pageSize: pageSize,
+	}
+}
+
+func (s *patternSource) Walk(ctx context.Context, cursor string, fn PageFunc) error {
+	if s.prefix == s.pattern {
+		if cursor != "" {
+			return nil
+		}
+		return fn([]string{s.pattern}, s.pattern)
+	}
+
+	// the catalog lists the names after last, the walk starts just before the prefix
+	// so that a repository named like the prefix itself is listed too
+	last := before(s.prefix)
+	if cursor != "" {
+		last = cursor
+	}
+
+	for {
+		repos, err := s.pager.RepoPage(ctx, last, s.pageSize)
+		if err != nil {
+			return err
+		}
+		if len(repos) == 0 || repos[len(repos)-1] == last {
+			return nil
+		}
+
+		matched := []string{}
+		pastPrefix := false
+		for _, r := range repos {
+			if !strings.HasPrefix(r, s.prefix) {
+				// the catalog is sorted, nothing after this can share the prefix
+				pastPrefix = r > s.prefix
+				if pastPrefix {
+					break
+				}
+				continue
+			}
+			if ok, _ := path.Match(s.pattern, r); ok {
+				matched = append(matched, r)
+			}
+		}
+		last = repos[len(repos)-1]
+
+		if len(matched) > 0 {
+			if err := fn(matched, last); err != nil {
+				return err
+			}
+		}
+		// only an empty page ends the catalog, registries may return less than asked for
+		if pastPrefix {
+			return nil
+		}
+	}
+}
+
+// before returns a name sorted before name but after any other name sorting before it
+// that is at least as long, e.g. "team-`" for "team-a". Names in between do not share
+// the prefix and are skipped by the walk.
+func before(name string) string {
+	if name == "" {
+		return ""
+	}
+	last := name[len(name)-1]
+	if last == 0 {
+		return name[:len(name)-1]
+	}
+	return name[:len(name)-1] + string([]byte{last - 1})
+}
@@ -17,16 +17,62 @@ package registry
 import (
 	"context"
 	"time"
-
-	v1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
 type RepoData struct {
 	Name          string
 	PullReference string
+	PullCommand   string
 	LastUpdatedAt time.Time
 }
 
+// PlatformData describes the image of a single platform. It is extracted when the tag is crawled
+// and is all that is kept about the image, pages are rendered from it without touching the registry.
+type PlatformData struct {
+	// Platform is in the os/arch[/variant] form, e.g. linux/arm64/v8
+	Platform  string
+	Digest    string
+	MediaType string
+	// Size is the compressed size of the config and of the layers
+	Size      int64
+	Layers    int
+	CreatedAt time.Time
+	// Labels come from the image configuration, Annotations from its manifest
+	Labels      map[string]string
+	Annotations map[string]string
+	Entrypoint  []string
+	Cmd         []string
+	// ExposedPorts are sorted, in the port/protocol form, e.g. 8080/tcp
+	ExposedPorts []string
+}
+
+// ImageInfo is what is known about the image a tag points to
+type ImageInfo struct {
+	Reference string
+	// PullCommand is the command to pull the tag with the tool suited to its kind
+	PullCommand string
+	// Digest and MediaType are those of the manifest, or index, the tag points to
+	Digest    string
+	MediaType string
+	// Index is true when the tag points to a multi-platform image index
+	Index bool
+	// Platforms lists the image of each platform, it has a single entry for single platform images and artifacts
+	Platforms []PlatformData
+	// Artifact is set when the tag points to a non-container artifact (Helm chart, SIF, WASM...)
+	Artifact *Artifact
+}
+
+// CreatedAt returns the creation time of the most recent platform image
+func (i ImageInfo) CreatedAt() time.Time {
+	created := time.Time{}
+	for _, p := range i.Platforms {
+		if p.CreatedAt.After(created) {
+			created = p.CreatedAt
+		}
+	}
+	return created
+}
+
 // Client interface defines methods for interacting with a container registry
 type Client interface {
 	// RepoList retrieves a list of repository names from the registry
@@ -36,5 +82,20 @@ type Client interface {
 	TagList(ctx context.Context, repo string) (tags []string, err error)
 
 	// ImageInfo retrieves detailed information about a specific image identified by its repository and tag
-	ImageInfo(ctx context.Context, repo string, tag string) (image v1.Image, reference string, err error)
+	ImageInfo(ctx context.Context, repo string, tag string) (info ImageInfo, err error)
+
+	// Referrers retrieves the artifacts (signatures, SBOMs, attestations...) attached to the image of a tag
+	Referrers(ctx context.Context, repo string, tag string) (referrers []Referrer, err error)
+}
+
+// Snapshotter is implemented by clients that can provide an immutable view of the registry,
+// so that several calls made to render a page all see the same data
+type Snapshotter interface {
+	Snapshot() Client
+}
+
+// SyncReporter is implemented by clients that synchronize the registry in the background
+type SyncReporter interface {
+	// LastSyncCompletedAt is when the last full synchronization completed, zero if none did yet
+	LastSyncCompletedAt() time.Time
 }
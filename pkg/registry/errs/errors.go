@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrNotFound         = errors.New("not found")
 	ErrInvalidReference = errors.New("invalid reference")
+	// ErrUntracked is returned for the metadata of tags left out by the tag policy, they are only known by name
+	ErrUntracked = errors.New("tag not tracked")
 )
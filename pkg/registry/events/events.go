@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kind tells what changed
+type Kind string
+
+const (
+	RepositoryCreated Kind = "repository.created"
+	RepositoryDeleted Kind = "repository.deleted"
+	TagCreated        Kind = "tag.created"
+	// TagUpdated is emitted when a tag moved to a different digest
+	TagUpdated Kind = "tag.updated"
+	TagDeleted Kind = "tag.deleted"
+)
+
+// Event is a change noticed by the crawler
+type Event struct {
+	Kind       Kind   `json:"kind"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	// Digest is the digest the tag points to, empty when not known
+	Digest string `json:"digest,omitempty"`
+	// PreviousDigest is the digest the tag pointed to before a TagUpdated event
+	PreviousDigest string    `json:"previousDigest,omitempty"`
+	At             time.Time `json:"at"`
+}
+
+func (e Event) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("kind", string(e.Kind)),
+		slog.String("repo", e.Repository),
+		slog.String("tag", e.Tag),
+		slog.String("digest", e.Digest),
+	)
+}
+
+// Bus delivers events to subscribers without ever blocking the publisher:
+// each subscriber has its own bounded queue and events are dropped when it is full
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	name    string
+	bus     *Bus
+	events  chan Event
+	dropped atomic.Uint64
+}
+
+// Subscribe creates a subscription whose queue holds up to size events, name identifies it in logs and metrics
+func (b *Bus) Subscribe(name string, size int) *Subscription {
+	s := &Subscription{
+		name:   name,
+		bus:    b,
+		events: make(chan Event, max(size, 1)),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Publish queues e for every subscriber, subscribers whose queue is full miss it
+func (b *Bus) Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		select {
+		case s.events <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Name is the name the subscription was created with
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// Events returns the queue of the subscription, it is closed by Close
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped is how many events were missed because the queue was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the delivery of events and closes the queue
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; !ok {
+		return
+	}
+	delete(s.bus.subs, s)
+	close(s.events)
+}
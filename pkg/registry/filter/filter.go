@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// regexpPrefix marks patterns that are regular expressions rather than globs
+const regexpPrefix = "re:"
+
+var ErrInvalidRule = errors.New("invalid filter rule")
+
+// Action is what happens to the repositories matched by a rule
+type Action int
+
+const (
+	// Include crawls and lists repositories, it is what happens to repositories no rule matches
+	Include Action = iota
+	// Hide crawls repositories without listing them, their page can still be opened
+	Hide
+	// Exclude neither crawls nor lists repositories
+	Exclude
+)
+
+func (a Action) String() string {
+	switch a {
+	case Hide:
+		return "hide"
+	case Exclude:
+		return "exclude"
+	default:
+		return "include"
+	}
+}
+
+// Pattern matches names against a path.Match glob, or a regular expression when written with the re: prefix.
+// Globs must match the whole name and * does not match /, regular expressions match anywhere in the name unless anchored.
+type Pattern struct {
+	spec string
+	re   *regexp.Regexp
+}
+
+// ParsePattern parses a glob, e.g. "tmp/*", or a regular expression, e.g. "re:^cache(/.*)?$"
+func ParsePattern(spec string) (Pattern, error) {
+	if expr, ok := strings.CutPrefix(spec, regexpPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return Pattern{}, err
+		}
+		return Pattern{spec: spec, re: re}, nil
+	}
+	if _, err := path.Match(spec, ""); err != nil {
+		return Pattern{}, err
+	}
+	return Pattern{spec: spec}, nil
+}
+
+// Matches tells if name matches the pattern
+func (p Pattern) Matches(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.spec, name)
+	return ok
+}
+
+func (p Pattern) String() string {
+	return p.spec
+}
+
+// Rule applies an action to the repositories matching a pattern
+type Rule struct {
+	Action  Action
+	Pattern Pattern
+}
+
+// ParseRule parses a rule written as <include|hide|exclude>:<pattern>, e.g. "exclude:tmp/*"
+// or "hide:re:^cache(/.*)?$", see ParsePattern for the syntax of patterns
+func ParseRule(spec string) (Rule, error) {
+	action, pattern, ok := strings.Cut(spec, ":")
+	if !ok || pattern == "" {
+		return Rule{}, fmt.Errorf("%w: %q, expected <include|hide|exclude>:<pattern>", ErrInvalidRule, spec)
+	}
+
+	rule := Rule{}
+	switch action {
+	case "include":
+		rule.Action = Include
+	case "hide":
+		rule.Action = Hide
+	case "exclude":
+		rule.Action = Exclude
+	default:
+		return Rule{}, fmt.Errorf("%w: %q, unknown action %q", ErrInvalidRule, spec, action)
+	}
+
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("%w: %q: %w", ErrInvalidRule, spec, err)
+	}
+	rule.Pattern = p
+	return rule, nil
+}
+
+func (r Rule) String() string {
+	return r.Action.String() + ":" + r.Pattern.String()
+}
+
+// Filter decides what happens to each repository of a registry. Rules are evaluated in order
+// and the first one matching a repository decides, repositories no rule matches are included.
+// A nil Filter includes everything.
+type Filter struct {
+	rules []Rule
+}
+
+// New parses the rules of a filter, see ParseRule for their syntax
+func New(specs []string) (*Filter, error) {
+	rules := make([]Rule, 0, len(specs))
+	for _, spec := range specs {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return &Filter{rules: rules}, nil
+}
+
+// Rules returns the rules of the filter, in the order they are evaluated
+func (f *Filter) Rules() []Rule {
+	if f == nil {
+		return nil
+	}
+	return f.rules
+}
+
+// Match returns the index of the first rule matching repo, -1 if none does
+func (f *Filter) Match(repo string) int {
+	for i, r := range f.Rules() {
+		if r.Pattern.Matches(repo) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Action returns what happens to repo
+func (f *Filter) Action(repo string) Action {
+	i := f.Match(repo)
+	if i < 0 {
+		return Include
+	}
+	return f.rules[i].Action
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package filter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		action  Action
+		matches []string
+		misses  []string
+	}{
+		{spec: "include:library/*", action: Include, matches: []string{"library/app"}, misses: []string{"library/app/sub", "library", "team/app"}},
+		{spec: "hide:tmp/*", action: Hide, matches: []string{"tmp/x"}, misses: []string{"tmp", "tmp/x/y"}},
+		{spec: "exclude:ci-[0-9]*", action: Exclude, matches: []string{"ci-1", "ci-42"}, misses: []string{"ci-x"}},
+		{spec: "exclude:re:^cache(/.*)?$", action: Exclude, matches: []string{"cache", "cache/a/b"}, misses: []string{"caches", "x/cache"}},
+		{spec: "hide:re:-dev$", action: Hide, matches: []string{"team/app-dev", "app-dev"}, misses: []string{"app-dev/x"}},
+		// regular expressions match anywhere unless anchored
+		{spec: "hide:re:test", action: Hide, matches: []string{"a/test/b", "latest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := ParseRule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.Action != tt.action {
+				t.Errorf("action %s, want %s", rule.Action, tt.action)
+			}
+			if rule.String() != tt.spec {
+				t.Errorf("String() = %q, want %q", rule.String(), tt.spec)
+			}
+			for _, name := range tt.matches {
+				if !rule.Pattern.Matches(name) {
+					t.Errorf("%q does not match", name)
+				}
+			}
+			for _, name := range tt.misses {
+				if rule.Pattern.Matches(name) {
+					t.Errorf("%q matches", name)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"tmp/*",
+		"exclude:",
+		"drop:tmp/*",
+		"Exclude:tmp/*",
+		"exclude:[",
+		"hide:re:(",
+		"hide:re:a**",
+	} {
+		if _, err := ParseRule(spec); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("ParseRule(%q) = %v, want ErrInvalidRule", spec, err)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f, err := New([]string{
+		"include:team/keep-*",
+		"exclude:team/*",
+		"hide:re:-dev$",
+		"exclude:re:.*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		repo   string
+		match  int
+		action Action
+	}{
+		// the first matching rule wins, even when later ones match too
+		{repo: "team/keep-app", match: 0, action: Include},
+		{repo: "team/app", match: 1, action: Exclude},
+		{repo: "team/app-dev", match: 1, action: Exclude},
+		{repo: "library/app-dev", match: 2, action: Hide},
+		{repo: "library/app", match: 3, action: Exclude},
+	}
+	for _, tt := range tests {
+		if got := f.Match(tt.repo); got != tt.match {
+			t.Errorf("Match(%q) = %d, want %d", tt.repo, got, tt.match)
+		}
+		if got := f.Action(tt.repo); got != tt.action {
+			t.Errorf("Action(%q) = %s, want %s", tt.repo, got, tt.action)
+		}
+	}
+}
+
+func TestFilterWithoutMatch(t *testing.T) {
+	f, err := New([]string{"exclude:tmp/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Match("library/app"); got != -1 {
+		t.Errorf("Match = %d, want -1", got)
+	}
+	if got := f.Action("library/app"); got != Include {
+		t.Errorf("Action = %s, want include", got)
+	}
+
+	var none *Filter
+	if none.Rules() != nil || none.Match("tmp/x") != -1 || none.Action("tmp/x") != Include {
+		t.Error("a nil filter does not include everything")
+	}
+	if _, err := New([]string{"exclude:tmp/*", "bad"}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("got %v, want ErrInvalidRule", err)
+	}
+}
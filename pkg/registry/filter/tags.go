@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/mod/semver"
+)
+
+var ErrInvalidTagRule = errors.New("invalid tag policy rule")
+
+// tagSelector returns the tags it selects among candidates
+type tagSelector func(candidates []string) []string
+
+// TagPolicy selects the tags of a repository whose metadata is synchronized, the other tags are only listed by name.
+// A tag is selected when it is not excluded and any of the other rules selects it, or when there are only
+// exclusion rules. A nil TagPolicy selects every tag.
+type TagPolicy struct {
+	selectors []tagSelector
+	excludes  []Pattern
+}
+
+// NewTagPolicy parses the rules of a tag policy, each one of:
+//   - "semver": tags that are versions, like 1.2.3, v1.2 or 2.0.0-rc.1
+//   - "match:<pattern>": tags matching the pattern, see ParsePattern
+//   - "channels:<tag>[,<tag>...]": tags with one of the given names, like latest or stable
+//   - "newest:<n>[:<pattern>]": the n newest tags matching the pattern, or among all tags.
+//     Versions are newer than other names, which are ordered comparing the numbers they contain.
+//   - "exclude:<pattern>": tags that are never selected, even by the other rules
+//
+// Without rules the policy is nil.
+func NewTagPolicy(specs []string) (*TagPolicy, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	p := &TagPolicy{}
+	for _, spec := range specs {
+		kind, arg, _ := strings.Cut(spec, ":")
+		switch kind {
+		case "semver":
+			p.selectors = append(p.selectors, selectSemver)
+		case "match":
+			pattern, err := ParsePattern(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q: %w", ErrInvalidTagRule, spec, err)
+			}
+			p.selectors = append(p.selectors, selectMatching(pattern))
+		case "channels":
+			if arg == "" {
+				return nil, fmt.Errorf("%w: %q, expected channels:<tag>[,<tag>...]", ErrInvalidTagRule, spec)
+			}
+			p.selectors = append(p.selectors, selectChannels(strings.Split(arg, ",")))
+		case "newest":
+			count, patternSpec, hasPattern := strings.Cut(arg, ":")
+			n, err := strconv.Atoi(count)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("%w: %q, expected newest:<n>[:<pattern>] with n > 0", ErrInvalidTagRule, spec)
+			}
+			var pattern *Pattern
+			if hasPattern {
+				parsed, err := ParsePattern(patternSpec)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %q: %w", ErrInvalidTagRule, spec, err)
+				}
+				pattern = &parsed
+			}
+			p.selectors = append(p.selectors, selectNewest(n, pattern))
+		case "exclude":
+			pattern, err := ParsePattern(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q: %w", ErrInvalidTagRule, spec, err)
+			}
+			p.excludes = append(p.excludes, pattern)
+		default:
+			return nil, fmt.Errorf("%w: %q, unknown rule %q", ErrInvalidTagRule, spec, kind)
+		}
+	}
+	return p, nil
+}
+
+// Select returns the tags selected by the policy, in the order they were given
+func (p *TagPolicy) Select(tags []string) []string {
+	if p == nil {
+		return tags
+	}
+
+	candidates := tags
+	if len(p.excludes) > 0 {
+		candidates = make([]string, 0, len(tags))
+		for _, t := range tags {
+			if !slices.ContainsFunc(p.excludes, func(e Pattern) bool { return e.Matches(t) }) {
+				candidates = append(candidates, t)
+			}
+		}
+	}
+	if len(p.selectors) == 0 {
+		return candidates
+	}
+
+	selected := map[string]struct{}{}
+	for _, sel := range p.selectors {
+		for _, t := range sel(candidates) {
+			selected[t] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(selected))
+	for _, t := range candidates {
+		if _, ok := selected[t]; ok {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func selectSemver(candidates []string) []string {
+	return slices.DeleteFunc(slices.Clone(candidates), func(t string) bool {
+		return !isVersion(t)
+	})
+}
+
+func selectMatching(pattern Pattern) tagSelector {
+	return func(candidates []string) []string {
+		return slices.DeleteFunc(slices.Clone(candidates), func(t string) bool {
+			return !pattern.Matches(t)
+		})
+	}
+}
+
+func selectChannels(channels []string) tagSelector {
+	return func(candidates []string) []string {
+		return slices.DeleteFunc(slices.Clone(candidates), func(t string) bool {
+			return !slices.Contains(channels, t)
+		})
+	}
+}
+
+func selectNewest(n int, pattern *Pattern) tagSelector {
+	return func(candidates []string) []string {
+		matching := slices.Clone(candidates)
+		if pattern != nil {
+			matching = slices.DeleteFunc(matching, func(t string) bool {
+				return !pattern.Matches(t)
+			})
+		}
+		slices.SortStableFunc(matching, func(a, b string) int {
+			return compareTags(b, a)
+		})
+		return matching[:min(n, len(matching))]
+	}
+}
+
+// isVersion tells if tag is a semantic version, the leading v being optional
+func isVersion(tag string) bool {
+	return semver.IsValid(canonicalVersion(tag))
+}
+
+func canonicalVersion(tag string) string {
+	if strings.HasPrefix(tag, "v") {
+		return tag
+	}
+	return "v" + tag
+}
+
+// compareTags orders tags from the oldest to the newest: versions are newer than other names,
+// which are compared chunk by chunk, numbers by value and the rest lexically
+func compareTags(a, b string) int {
+	aVersion, bVersion := isVersion(a), isVersion(b)
+	switch {
+	case aVersion && bVersion:
+		if c := semver.Compare(canonicalVersion(a), canonicalVersion(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	case aVersion:
+		return 1
+	case bVersion:
+		return -1
+	}
+
+	for a != "" && b != "" {
+		var aChunk, bChunk string
+		aChunk, a = nextChunk(a)
+		bChunk, b = nextChunk(b)
+		aNum, aErr := strconv.ParseUint(aChunk, 10, 64)
+		bNum, bErr := strconv.ParseUint(bChunk, 10, 64)
+		if aErr == nil && bErr == nil {
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if c := strings.Compare(aChunk, bChunk); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// nextChunk splits s after its leading run of digits or non-digits
+func nextChunk(s string) (string, string) {
+	digits := unicode.IsDigit(rune(s[0]))
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsDigit(r) != digits
+	})
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package filter
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestTagPolicySelect(t *testing.T) {
+	tags := []string{"latest", "stable", "1.0.0", "1.1.0", "2.0.0-rc.1", "v2.0.0", "main-8", "main-9", "main-10", "pr-3", "nightly"}
+	tests := []struct {
+		name  string
+		specs []string
+		want  []string
+	}{
+		{name: "semver", specs: []string{"semver"}, want: []string{"1.0.0", "1.1.0", "2.0.0-rc.1", "v2.0.0"}},
+		{name: "channels", specs: []string{"channels:latest,stable"}, want: []string{"latest", "stable"}},
+		{name: "match", specs: []string{"match:main-*"}, want: []string{"main-8", "main-9", "main-10"}},
+		{name: "newest versions first", specs: []string{"newest:2"}, want: []string{"2.0.0-rc.1", "v2.0.0"}},
+		{name: "newest matching", specs: []string{"newest:2:main-*"}, want: []string{"main-9", "main-10"}},
+		{name: "newest more than there are", specs: []string{"newest:5:re:^main-"}, want: []string{"main-8", "main-9", "main-10"}},
+		{
+			name:  "rules add up",
+			specs: []string{"channels:latest", "newest:1:main-*", "semver"},
+			want:  []string{"latest", "1.0.0", "1.1.0", "2.0.0-rc.1", "v2.0.0", "main-10"},
+		},
+		{name: "exclude only", specs: []string{"exclude:pr-*", "exclude:nightly"}, want: []string{"latest", "stable", "1.0.0", "1.1.0", "2.0.0-rc.1", "v2.0.0", "main-8", "main-9", "main-10"}},
+		{name: "exclude wins", specs: []string{"channels:latest", "exclude:latest"}, want: []string{}},
+		{name: "exclude pre-releases", specs: []string{"semver", "exclude:*-rc.*"}, want: []string{"1.0.0", "1.1.0", "v2.0.0"}},
+		// excluded tags are left out before the newest ones are picked
+		{name: "exclude before newest", specs: []string{"newest:1", "exclude:v2.0.0"}, want: []string{"2.0.0-rc.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewTagPolicy(tt.specs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			given := slices.Clone(tags)
+			if got := p.Select(given); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(given, tags) {
+				t.Errorf("the tags were modified: %v", given)
+			}
+		})
+	}
+}
+
+func TestTagPolicyNil(t *testing.T) {
+	p, err := NewTagPolicy(nil)
+	if err != nil || p != nil {
+		t.Fatalf("got %v, %v, want a nil policy", p, err)
+	}
+	tags := []string{"latest", "1.0.0"}
+	if got := p.Select(tags); !slices.Equal(got, tags) {
+		t.Errorf("got %v, want every tag", got)
+	}
+}
+
+func TestNewTagPolicyErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"oldest:3",
+		"newest",
+		"newest:0",
+		"newest:-1",
+		"newest:x",
+		"newest:2:[",
+		"channels:",
+		"match:[",
+		"exclude:re:(",
+	} {
+		if _, err := NewTagPolicy([]string{"semver", spec}); !errors.Is(err, ErrInvalidTagRule) {
+			t.Errorf("NewTagPolicy(%q) = %v, want ErrInvalidTagRule", spec, err)
+		}
+	}
+}
+
+func TestIsVersion(t *testing.T) {
+	tests := map[string]bool{
+		"1.2.3":         true,
+		"v1.2.3":        true,
+		"v1.2":          true,
+		"1":             true,
+		"2.0.0-rc.1":    true,
+		"1.2.3+build.5": true,
+		"01.2.3":        false,
+		"1.2.3.4":       false,
+		"latest":        false,
+		"main-42":       false,
+		"vnext":         false,
+	}
+	for tag, want := range tests {
+		if got := isVersion(tag); got != want {
+			t.Errorf("isVersion(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestCompareTags(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.2.3", b: "1.10.0", want: -1},
+		{a: "2.0.0-rc.1", b: "2.0.0", want: -1},
+		{a: "2.0.0-rc.2", b: "2.0.0-rc.10", want: -1},
+		{a: "v1.2", b: "1.1.9", want: 1},
+		// the same version written twice is ordered by name so that sorting is stable
+		{a: "v1.2.0", b: "1.2.0", want: 1},
+		{a: "1.0.0", b: "latest", want: 1},
+		{a: "zzz", b: "0.0.1", want: -1},
+		{a: "build-9", b: "build-10", want: -1},
+		{a: "build-10", b: "build-9", want: 1},
+		{a: "main-2024.01.02", b: "main-2024.1.3", want: -1},
+		{a: "abc", b: "abd", want: -1},
+		{a: "app", b: "app-1", want: -1},
+		{a: "nightly", b: "nightly", want: 0},
+	}
+	for _, tt := range tests {
+		if got := compareTags(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareTags(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareTags(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareTags(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
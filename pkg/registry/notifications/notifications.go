@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notifications
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MediaType is the media type of the envelopes sent by distribution compatible registries
+const MediaType = "application/vnd.docker.distribution.events.v1+json"
+
+// Actions of the events that are acted upon, others (pull, mount) are ignored
+const (
+	ActionPush   = "push"
+	ActionDelete = "delete"
+)
+
+var ErrInvalidEnvelope = errors.New("invalid notification envelope")
+
+// Envelope is the body of a notification sent by distribution, it holds one or more events
+type Envelope struct {
+	Events []Event `json:"events"`
+}
+
+// Event is a single registry event, only the fields staticreg needs are decoded
+type Event struct {
+	ID      string  `json:"id"`
+	Action  string  `json:"action"`
+	Target  Target  `json:"target"`
+	Request Request `json:"request"`
+}
+
+type Target struct {
+	MediaType  string `json:"mediaType"`
+	Digest     string `json:"digest"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+}
+
+type Request struct {
+	// Host is the registry hostname the event happened on, as seen by the registry
+	Host string `json:"host"`
+}
+
+// Parse decodes an envelope, events without a repository are dropped
+func Parse(r io.Reader) (*Envelope, error) {
+	env := &Envelope{}
+	if err := json.NewDecoder(r).Decode(env); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEnvelope, err)
+	}
+	events := env.Events[:0]
+	for _, e := range env.Events {
+		if e.Target.Repository == "" {
+			continue
+		}
+		events = append(events, e)
+	}
+	env.Events = events
+	return env, nil
+}
+
+// IsDigestDelete tells if the event is the deletion of a manifest by digest. Distribution only sends
+// the repository and the digest then, so blob deletions look the same: they match no tag.
+func (e Event) IsDigestDelete() bool {
+	return e.Action == ActionDelete && e.Target.Tag == "" && e.Target.Digest != ""
+}
+
+// IsRepositoryDelete tells if the event is the deletion of a whole repository
+func (e Event) IsRepositoryDelete() bool {
+	return e.Action == ActionDelete && e.Target.Tag == "" && e.Target.Digest == ""
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+// Annotations used by the tools writing OCI layouts to name what they contain
+const (
+	annotationRefName        = "org.opencontainers.image.ref.name"
+	annotationContainerdName = "io.containerd.image.name"
+)
+
+// layoutMarker is the file at the root of every OCI image layout
+const layoutMarker = "oci-layout"
+
+// findLayouts returns the index.json of path if it is a layout, or of every layout found under it
+func findLayouts(root string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(root, layoutMarker)); err == nil {
+		return []string{filepath.Join(root, "index.json")}, nil
+	}
+
+	files := []string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != root {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(p, layoutMarker)); err == nil {
+			files = append(files, filepath.Join(p, "index.json"))
+			// blobs of a layout are not worth walking
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return files, err
+}
+
+// readLayout lists the manifests of the layout whose index is indexPath. A manifest belongs to the
+// repository named by its containerd annotation, or to the repository named after the layout directory.
+func (b *Backend) readLayout(indexPath string) ([]*entry, error) {
+	dir := filepath.Dir(indexPath)
+	lp, err := layout.FromPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := lp.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultRepo := filepath.ToSlash(filepath.Base(dir))
+	if rel, err := filepath.Rel(b.path, dir); err == nil && rel != "." {
+		defaultRepo = filepath.ToSlash(rel)
+	}
+	defaultRepo = strings.ToLower(defaultRepo)
+
+	entries := make([]*entry, 0, len(manifest.Manifests))
+	for _, desc := range manifest.Manifests {
+		repo, tag := layoutRepoAndTag(defaultRepo, desc)
+		refName := desc.Annotations[annotationRefName]
+		e := &entry{
+			repo:   repo,
+			tag:    tag,
+			digest: desc.Digest,
+			pullCommand: func(kind registry.ArtifactKind) string {
+				if kind != "" {
+					return fmt.Sprintf("oras pull --oci-layout %s@%s", dir, desc.Digest)
+				}
+				if refName == "" {
+					return fmt.Sprintf("skopeo copy oci:%s@%s docker-daemon:%s:%s", dir, desc.Digest, repo, tag)
+				}
+				return fmt.Sprintf("skopeo copy oci:%s:%s docker-daemon:%s:%s", dir, refName, repo, tag)
+			},
+		}
+		switch {
+		case desc.MediaType.IsIndex():
+			e.index = func() (v1.ImageIndex, error) {
+				return idx.ImageIndex(desc.Digest)
+			}
+		case desc.MediaType.IsImage():
+			e.image = func() (v1.Image, error) {
+				return lp.Image(desc.Digest)
+			}
+		default:
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// layoutRepoAndTag names a manifest of a layout. Skopeo and oras only set the ref name annotation
+// to the tag, containerd and buildkit put the full image reference in it or in their own annotation.
+func layoutRepoAndTag(defaultRepo string, desc v1.Descriptor) (string, string) {
+	for _, ref := range []string{desc.Annotations[annotationContainerdName], desc.Annotations[annotationRefName]} {
+		if !strings.ContainsAny(ref, "/:") {
+			continue
+		}
+		if repo, tag, err := repoAndTag(ref); err == nil {
+			return repo, tag
+		}
+	}
+	return defaultRepo, desc.Annotations[annotationRefName]
+}
+
+// manifestWithSubject holds the fields of a manifest needed to tell if it is a referrer
+type manifestWithSubject struct {
+	v1.Manifest
+	ArtifactType string `json:"artifactType"`
+}
+
+// referrerOf tells if img refers to the manifest with the given digest through its subject
+func referrerOf(img v1.Image, digest string) (registry.Referrer, bool) {
+	raw, err := img.RawManifest()
+	if err != nil {
+		return registry.Referrer{}, false
+	}
+	m := &manifestWithSubject{}
+	if err := json.Unmarshal(raw, m); err != nil || m.Subject == nil || m.Subject.Digest.String() != digest {
+		return registry.Referrer{}, false
+	}
+
+	d, err := img.Digest()
+	if err != nil {
+		return registry.Referrer{}, false
+	}
+	artifactType := m.ArtifactType
+	if artifactType == "" {
+		artifactType = string(m.Config.MediaType)
+	}
+	return registry.Referrer{
+		ArtifactType: artifactType,
+		Digest:       d.String(),
+		MediaType:    string(m.MediaType),
+		Size:         int64(len(raw)),
+		Annotations:  m.Annotations,
+	}, true
+}
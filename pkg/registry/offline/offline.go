@@ -0,0 +1,334 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package offline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+	registryimpl "github.com/seqeralabs/staticreg/pkg/registry/registry"
+)
+
+// Kinds of offline sources
+const (
+	KindOCILayout = "oci-layout"
+	KindTarball   = "tarball"
+)
+
+var ErrInvalidSource = errors.New("invalid source")
+
+// Backend serves the images found on disk, either in OCI image layouts or in docker save tarballs,
+// so that they can be browsed without a registry. Files are scanned again at the beginning of every
+// catalog walk, changes are picked up by the next synchronization.
+type Backend struct {
+	kind string
+	path string
+
+	mu    sync.RWMutex
+	repos []string
+	tags  map[string]map[string]*entry
+	// untagged are the manifests of a layout that no tag points to, they are looked at to find referrers
+	untagged map[string][]*entry
+	// scanned keeps the result of the previous scan of each file, indexed by path, to only read the ones that changed
+	scanned map[string]scannedFile
+}
+
+// entry is a manifest found on disk
+type entry struct {
+	repo string
+	tag  string
+	// digest is known upfront for layouts, computed when first needed for tarballs
+	digest     v1.Hash
+	digestOnce sync.Once
+	digestErr  error
+
+	image       func() (v1.Image, error)
+	index       func() (v1.ImageIndex, error)
+	pullCommand func(kind registry.ArtifactKind) string
+}
+
+// scannedFile is the outcome of reading index.json of a layout or manifest.json of a tarball
+type scannedFile struct {
+	size    int64
+	modTime time.Time
+	entries []*entry
+}
+
+// New creates the backend described by spec, which is "oci-layout:<path>" or "tarball:<path>".
+// The path is a single layout or tarball, or a directory containing several of them.
+func New(spec string) (*Backend, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	if kind != KindOCILayout && kind != KindTarball {
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidSource, kind)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%w: missing path in %q", ErrInvalidSource, spec)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return &Backend{
+		kind:    kind,
+		path:    filepath.Clean(path),
+		scanned: map[string]scannedFile{},
+	}, nil
+}
+
+// IsOffline tells if spec describes an offline source rather than a registry
+func IsOffline(spec string) bool {
+	kind, _, _ := strings.Cut(spec, ":")
+	return kind == KindOCILayout || kind == KindTarball
+}
+
+// RepoPage implements catalog.Pager over the repositories found on disk
+func (b *Backend) RepoPage(ctx context.Context, last string, n int) ([]string, error) {
+	if last == "" {
+		if err := b.scan(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	start := 0
+	if last != "" {
+		start = sort.SearchStrings(b.repos, last)
+		if start < len(b.repos) && b.repos[start] == last {
+			start++
+		}
+	}
+	end := min(start+n, len(b.repos))
+	return append([]string{}, b.repos[start:end]...), nil
+}
+
+func (b *Backend) TagList(ctx context.Context, repo string) ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	tags, ok := b.tags[repo]
+	if !ok {
+		return nil, fmt.Errorf("%w: repository %s", errs.ErrNotFound, repo)
+	}
+	list := make([]string, 0, len(tags))
+	for t := range tags {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func (b *Backend) ImageInfo(ctx context.Context, repo string, tag string) (registry.ImageInfo, error) {
+	e, err := b.entry(repo, tag)
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	ref, err := name.NewTag(repo+":"+tag, name.WithDefaultRegistry(""))
+	if err != nil {
+		return registry.ImageInfo{}, fmt.Errorf("%w: %s", errs.ErrInvalidReference, err)
+	}
+
+	var info registry.ImageInfo
+	if e.index != nil {
+		idx, err := e.index()
+		if err != nil {
+			return registry.ImageInfo{}, err
+		}
+		info, err = registryimpl.DescribeIndex(ctx, ref, idx)
+		if err != nil {
+			return registry.ImageInfo{}, err
+		}
+	} else {
+		img, err := e.image()
+		if err != nil {
+			return registry.ImageInfo{}, err
+		}
+		info, err = registryimpl.DescribeImage(ctx, ref, img)
+		if err != nil {
+			return registry.ImageInfo{}, err
+		}
+	}
+
+	kind := registry.ArtifactKind("")
+	if info.Artifact != nil {
+		kind = info.Artifact.Kind
+	}
+	info.PullCommand = e.pullCommand(kind)
+	return info, nil
+}
+
+func (b *Backend) Digest(ctx context.Context, repo string, tag string) (string, error) {
+	e, err := b.entry(repo, tag)
+	if err != nil {
+		return "", err
+	}
+	d, err := e.manifestDigest()
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+// Referrers returns the untagged manifests of the repository whose subject is digest
+func (b *Backend) Referrers(ctx context.Context, repo string, digest string) ([]registry.Referrer, error) {
+	b.mu.RLock()
+	untagged := b.untagged[repo]
+	b.mu.RUnlock()
+
+	referrers := []registry.Referrer{}
+	for _, e := range untagged {
+		if e.image == nil {
+			continue
+		}
+		img, err := e.image()
+		if err != nil {
+			logger.FromContext(ctx).Debug("could not read untagged manifest", logger.ErrAttr(err), slog.String("repo", repo))
+			continue
+		}
+		if r, ok := referrerOf(img, digest); ok {
+			referrers = append(referrers, r)
+		}
+	}
+	return referrers, nil
+}
+
+func (b *Backend) entry(repo string, tag string) (*entry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	e, ok := b.tags[repo][tag]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s:%s", errs.ErrNotFound, repo, tag)
+	}
+	return e, nil
+}
+
+func (e *entry) manifestDigest() (v1.Hash, error) {
+	e.digestOnce.Do(func() {
+		if e.digest != (v1.Hash{}) {
+			return
+		}
+		img, err := e.image()
+		if err != nil {
+			e.digestErr = err
+			return
+		}
+		e.digest, e.digestErr = img.Digest()
+	})
+	return e.digest, e.digestErr
+}
+
+// scan looks for layouts or tarballs under the backend path and rebuilds the repositories from them
+func (b *Backend) scan(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+
+	var files []string
+	var err error
+	switch b.kind {
+	case KindOCILayout:
+		files, err = findLayouts(b.path)
+	case KindTarball:
+		files, err = findTarballs(b.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	scanned := make(map[string]scannedFile, len(files))
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		if prev, ok := b.scanned[f]; ok && prev.size == info.Size() && prev.modTime.Equal(info.ModTime()) {
+			scanned[f] = prev
+			continue
+		}
+
+		var entries []*entry
+		switch b.kind {
+		case KindOCILayout:
+			entries, err = b.readLayout(f)
+		case KindTarball:
+			entries, err = readTarball(f)
+		}
+		if err != nil {
+			// a single broken file must not hide all the others
+			log.Warn("could not read offline source, skipping it", logger.ErrAttr(err), slog.String("path", f))
+			continue
+		}
+		scanned[f] = scannedFile{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			entries: entries,
+		}
+	}
+
+	tags := map[string]map[string]*entry{}
+	untagged := map[string][]*entry{}
+	for _, f := range files {
+		for _, e := range scanned[f].entries {
+			if e.tag == "" {
+				untagged[e.repo] = append(untagged[e.repo], e)
+				continue
+			}
+			if tags[e.repo] == nil {
+				tags[e.repo] = map[string]*entry{}
+			}
+			tags[e.repo][e.tag] = e
+		}
+	}
+	repos := make([]string, 0, len(tags))
+	for r := range tags {
+		repos = append(repos, r)
+	}
+	sort.Strings(repos)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.repos = repos
+	b.tags = tags
+	b.untagged = untagged
+	b.scanned = scanned
+	log.Debug("offline source scanned", slog.String("path", b.path), slog.Int("files", len(files)), slog.Int("repositories", len(repos)))
+	return nil
+}
+
+// repoAndTag splits a full image reference as found in tarballs and layout annotations into the
+// repository and tag shown by staticreg. Docker Hub references lose their registry and library/ prefix.
+func repoAndTag(ref string) (string, string, error) {
+	tag, err := name.NewTag(ref)
+	if err != nil {
+		return "", "", err
+	}
+	repo := tag.RepositoryStr()
+	if tag.RegistryStr() == name.DefaultRegistry {
+		repo = strings.TrimPrefix(repo, "library/")
+	} else {
+		repo = tag.RegistryStr() + "/" + repo
+	}
+	return repo, tag.TagStr(), nil
+}
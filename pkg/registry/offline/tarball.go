@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package offline
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+// findTarballs returns path if it is a file, or the .tar files found under it
+func findTarballs(root string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+
+	files := []string{}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), ".") && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), ".tar") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// readTarball lists the images of a docker save tarball, one entry per repository tag.
+// Images saved without a tag are not listed, there is nothing to name them after.
+func readTarball(path string) ([]*entry, error) {
+	opener := func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	manifest, err := tarball.LoadManifest(opener)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*entry{}
+	for _, desc := range manifest {
+		for _, repoTag := range desc.RepoTags {
+			tag, err := name.NewTag(repoTag)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			repo, tagStr, err := repoAndTag(repoTag)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			entries = append(entries, &entry{
+				repo: repo,
+				tag:  tagStr,
+				image: func() (v1.Image, error) {
+					return tarball.Image(opener, &tag)
+				},
+				pullCommand: func(registry.ArtifactKind) string {
+					return "docker load -i " + path
+				},
+			})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Artifact types of the cosign tag scheme, used for artifacts found through sha256-<digest>.<suffix> tags
+const (
+	ArtifactTypeCosignSignature   = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	ArtifactTypeCosignSBOM        = "application/vnd.dev.cosign.artifact.sbom.v1+json"
+	ArtifactTypeCosignAttestation = "application/vnd.dsse.envelope.v1+json"
+)
+
+// referrerTagRegexp matches the tags of the referrers tag schema (sha256-<hex>) and of cosign (sha256-<hex>.sig|att|sbom)
+var referrerTagRegexp = regexp.MustCompile(`^(sha256)-([a-f0-9]{64})(?:\.(sig|att|sbom))?$`)
+
+// Referrer is an artifact (signature, SBOM, attestation...) attached to an image
+type Referrer struct {
+	ArtifactType string
+	Digest       string
+	MediaType    string
+	Size         int64
+	Annotations  map[string]string
+	// Tag is set when the referrer was found through a fallback tag rather than the referrers API
+	Tag string
+}
+
+// ParseReferrerTag tells if tag is a referrers fallback tag and returns the digest of the image it refers to.
+// artifactType is empty for the OCI referrers tag schema, where the tag points to an index of referrers.
+func ParseReferrerTag(tag string) (digest string, artifactType string, ok bool) {
+	m := referrerTagRegexp.FindStringSubmatch(tag)
+	if m == nil {
+		return "", "", false
+	}
+	switch m[3] {
+	case "sig":
+		artifactType = ArtifactTypeCosignSignature
+	case "sbom":
+		artifactType = ArtifactTypeCosignSBOM
+	case "att":
+		artifactType = ArtifactTypeCosignAttestation
+	}
+	return m[1] + ":" + m[2], artifactType, true
+}
+
+// ReferrerKind returns a human friendly name for the kind of artifact identified by artifactType
+func ReferrerKind(artifactType string) string {
+	switch {
+	case artifactType == ArtifactTypeCosignSignature,
+		artifactType == "application/vnd.cncf.notary.signature",
+		strings.HasPrefix(artifactType, "application/vnd.dev.sigstore.bundle"):
+		return "Signature"
+	case artifactType == ArtifactTypeCosignSBOM,
+		strings.HasPrefix(artifactType, "application/spdx"),
+		strings.HasPrefix(artifactType, "text/spdx"),
+		strings.HasPrefix(artifactType, "application/vnd.cyclonedx"),
+		strings.HasPrefix(artifactType, "application/vnd.syft"):
+		return "SBOM"
+	case artifactType == ArtifactTypeCosignAttestation,
+		strings.HasPrefix(artifactType, "application/vnd.in-toto"):
+		return "Attestation"
+	}
+	return "Artifact"
+}
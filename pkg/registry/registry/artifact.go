@@ -0,0 +1,306 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+// sifMagic identifies a Singularity image file, it follows the 32 bytes launch script
+const sifMagic = "SIF_MAGIC"
+
+// sifHeaderSize is how much of a SIF file is needed to read its global header
+const sifHeaderSize = 32 + 10 + 3 + 3 + 16 + 8 + 8
+
+var ErrNotSIF = errors.New("not a SIF file")
+
+// sifArchs maps the architecture codes of the SIF header to GOARCH names
+var sifArchs = map[string]string{
+	"01": "386",
+	"02": "amd64",
+	"03": "arm",
+	"04": "arm64",
+	"05": "ppc64",
+	"06": "ppc64le",
+	"07": "mips",
+	"08": "mipsle",
+	"09": "mips64",
+	"10": "mips64le",
+	"11": "s390x",
+	"12": "riscv64",
+}
+
+// manifestWithArtifactType is a manifest or an index along with the artifactType
+// field of OCI 1.1, which v1.Manifest and v1.IndexManifest do not have
+type manifestWithArtifactType struct {
+	v1.Manifest
+	ArtifactType string `json:"artifactType"`
+}
+
+// isContainerImage tells if a manifest describes a container image rather than an artifact
+func isContainerImage(m *manifestWithArtifactType) bool {
+	if m.ArtifactType != "" {
+		return false
+	}
+	return m.Config.MediaType == types.OCIConfigJSON || m.Config.MediaType == types.DockerConfigJSON
+}
+
+// artifactInfo describes a tag pointing to a non-container artifact.
+// Failing to read the kind specific metadata is not an error, the artifact is still listed without it.
+func artifactInfo(ctx context.Context, ref name.Reference, img v1.Image, m *manifestWithArtifactType) (registry.ImageInfo, error) {
+	log := logger.FromContext(ctx)
+
+	digest, err := img.Digest()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+
+	artifact := &registry.Artifact{
+		Type:        m.ArtifactType,
+		Files:       make([]registry.ArtifactFile, 0, len(m.Layers)),
+		Annotations: m.Annotations,
+	}
+	if artifact.Type == "" {
+		artifact.Type = string(m.Config.MediaType)
+	}
+
+	size := m.Config.Size
+	for _, l := range m.Layers {
+		size += l.Size
+		artifact.Files = append(artifact.Files, registry.ArtifactFile{
+			Name:      l.Annotations[registry.AnnotationTitle],
+			MediaType: string(l.MediaType),
+			Digest:    l.Digest.String(),
+			Size:      l.Size,
+		})
+	}
+	artifact.Kind = registry.ArtifactKindOf(artifact.Type, artifact.Files)
+
+	platform := registry.PlatformData{
+		Digest:      digest.String(),
+		MediaType:   string(mediaType),
+		Size:        size,
+		Layers:      len(m.Layers),
+		CreatedAt:   annotationTime(m.Annotations),
+		Annotations: m.Annotations,
+	}
+
+	switch artifact.Kind {
+	case registry.ArtifactKindHelm:
+		chart := &registry.HelmChart{}
+		if err := unmarshalConfig(img, chart); err != nil {
+			log.Warn("could not read Helm chart metadata", logger.ErrAttr(err), slog.String("ref", ref.String()))
+		} else {
+			artifact.Helm = chart
+		}
+	case registry.ArtifactKindWASM:
+		wasm := &registry.WASMConfig{}
+		if err := unmarshalConfig(img, wasm); err != nil {
+			log.Warn("could not read WASM config", logger.ErrAttr(err), slog.String("ref", ref.String()))
+		} else {
+			artifact.WASM = wasm
+			if platform.CreatedAt.IsZero() {
+				platform.CreatedAt = wasm.Created
+			}
+			if wasm.OS != "" && wasm.Architecture != "" {
+				platform.Platform = wasm.OS + "/" + wasm.Architecture
+			}
+		}
+	case registry.ArtifactKindSIF:
+		header, err := sifHeader(img, m)
+		if err != nil {
+			log.Warn("could not read SIF header", logger.ErrAttr(err), slog.String("ref", ref.String()))
+		} else {
+			artifact.SIF = header
+			if platform.CreatedAt.IsZero() {
+				platform.CreatedAt = header.CreatedAt
+			}
+			if header.Arch != "" {
+				platform.Platform = "linux/" + header.Arch
+			}
+		}
+	}
+
+	return registry.ImageInfo{
+		Reference:   ref.String(),
+		PullCommand: pullCommand(ref, artifact.Kind),
+		Digest:      digest.String(),
+		MediaType:   string(mediaType),
+		Platforms:   []registry.PlatformData{platform},
+		Artifact:    artifact,
+	}, nil
+}
+
+// indexArtifactInfo describes a tag pointing to an index that contains no container images,
+// the manifests it contains are listed as the files of a generic artifact
+func indexArtifactInfo(ref name.Reference, index v1.ImageIndex, idx *v1.IndexManifest) (registry.ImageInfo, error) {
+	digest, err := index.Digest()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	mediaType, err := index.MediaType()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	raw, err := index.RawManifest()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	m := &manifestWithArtifactType{}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return registry.ImageInfo{}, err
+	}
+
+	artifact := &registry.Artifact{
+		Kind:        registry.ArtifactKindGeneric,
+		Type:        m.ArtifactType,
+		Files:       make([]registry.ArtifactFile, 0, len(idx.Manifests)),
+		Annotations: idx.Annotations,
+	}
+	if artifact.Type == "" {
+		artifact.Type = string(mediaType)
+	}
+
+	size := int64(0)
+	for _, d := range idx.Manifests {
+		size += d.Size
+		name := d.Annotations[registry.AnnotationTitle]
+		if name == "" && d.Platform != nil {
+			name = d.Platform.String()
+		}
+		artifact.Files = append(artifact.Files, registry.ArtifactFile{
+			Name:      name,
+			MediaType: string(d.MediaType),
+			Digest:    d.Digest.String(),
+			Size:      d.Size,
+		})
+	}
+
+	return registry.ImageInfo{
+		Reference:   ref.String(),
+		PullCommand: pullCommand(ref, artifact.Kind),
+		Digest:      digest.String(),
+		MediaType:   string(mediaType),
+		Index:       true,
+		Platforms: []registry.PlatformData{{
+			Digest:      digest.String(),
+			MediaType:   string(mediaType),
+			Size:        size,
+			CreatedAt:   annotationTime(idx.Annotations),
+			Annotations: idx.Annotations,
+		}},
+		Artifact: artifact,
+	}, nil
+}
+
+// pullCommand returns the command to pull ref with the tool suited to its kind, kind is empty for container images
+func pullCommand(ref name.Reference, kind registry.ArtifactKind) string {
+	switch kind {
+	case "":
+		return "docker pull " + ref.String()
+	case registry.ArtifactKindHelm:
+		return fmt.Sprintf("helm pull oci://%s --version %s", ref.Context().String(), ref.Identifier())
+	case registry.ArtifactKindSIF:
+		return "singularity pull oras://" + ref.String()
+	}
+	return "oras pull " + ref.String()
+}
+
+func unmarshalConfig(img v1.Image, v any) error {
+	raw, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// sifHeader reads the global header at the beginning of the SIF layer, without downloading the rest of it
+func sifHeader(img v1.Image, m *manifestWithArtifactType) (*registry.SIFHeader, error) {
+	var layer *v1.Descriptor
+	for i, l := range m.Layers {
+		if l.MediaType == registry.MediaTypeSIFLayer {
+			layer = &m.Layers[i]
+			break
+		}
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("%w: no SIF layer", ErrNotSIF)
+	}
+
+	l, err := img.LayerByDigest(layer.Digest)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	buf := make([]byte, sifHeaderSize)
+	if _, err := io.ReadFull(rc, buf); err != nil {
+		return nil, err
+	}
+	return parseSIFHeader(buf)
+}
+
+func parseSIFHeader(buf []byte) (*registry.SIFHeader, error) {
+	magic := buf[32:42]
+	if string(bytes.TrimRight(magic, "\x00")) != sifMagic {
+		return nil, ErrNotSIF
+	}
+	version := string(bytes.TrimRight(buf[42:45], "\x00"))
+	arch := string(bytes.TrimRight(buf[45:48], "\x00"))
+	id := buf[48:64]
+	created := int64(binary.LittleEndian.Uint64(buf[64:72]))
+	modified := int64(binary.LittleEndian.Uint64(buf[72:80]))
+
+	header := &registry.SIFHeader{
+		Version:    version,
+		Arch:       sifArchs[arch],
+		ID:         fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]),
+		CreatedAt:  time.Unix(created, 0).UTC(),
+		ModifiedAt: time.Unix(modified, 0).UTC(),
+	}
+	return header, nil
+}
+
+// annotationTime returns the org.opencontainers.image.created annotation, zero if it is missing or invalid
+func annotationTime(annotations map[string]string) time.Time {
+	t, err := time.Parse(time.RFC3339, annotations[registry.AnnotationCreated])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
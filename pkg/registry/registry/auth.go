@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// staticKeychain resolves every resource to the same set of credentials
+type staticKeychain struct {
+	auth authn.Authenticator
+}
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return k.auth, nil
+}
+
+// newKeychain builds the keychain used to authenticate against the registry.
+// Static credentials always win, the docker config (including credential helpers)
+// is only consulted when explicitly enabled.
+// Challenges, token exchanges and token caching are handled by ggcr's transport,
+// which resolves the credentials from the keychain for each repository scope.
+func newKeychain(user string, password string, useDockerConfig bool) authn.Keychain {
+	keychains := []authn.Keychain{}
+	if user != "" || password != "" {
+		keychains = append(keychains, staticKeychain{auth: &authn.Basic{
+			Username: user,
+			Password: password,
+		}})
+	}
+	if useDockerConfig {
+		keychains = append(keychains, authn.DefaultKeychain)
+	}
+	return authn.NewMultiKeychain(keychains...)
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/seqeralabs/staticreg/pkg/cfg"
+)
+
+const (
+	testUser     = "crawler"
+	testPassword = "s3cret"
+	testRepo     = "team/app"
+)
+
+// newTestRegistry starts ggcr's in-process registry with an image pushed as team/app:1.0,
+// it returns the registry handler so that it can be served behind an auth-checking handler
+func newTestRegistry(t *testing.T) http.Handler {
+	t.Helper()
+	reg := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+	upstream := httptest.NewServer(reg)
+	t.Cleanup(upstream.Close)
+
+	ref, err := name.ParseReference(fmt.Sprintf("%s/%s:1.0", strings.TrimPrefix(upstream.URL, "http://"), testRepo), name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server, user string, password string) *Registry {
+	t.Helper()
+	client, err := New(&cfg.Registry{
+		Hostname: strings.TrimPrefix(srv.URL, "http://"),
+		User:     user,
+		Password: password,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestBasicAuth(t *testing.T) {
+	reg := newTestRegistry(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != testUser || password != testPassword {
+			w.Header().Set("WWW-Authenticate", `Basic realm="staticreg-test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	client := newTestClient(t, srv, testUser, testPassword)
+	tags, err := client.TagList(ctx, testRepo)
+	if err != nil {
+		t.Fatalf("listing tags: %v", err)
+	}
+	if !slices.Equal(tags, []string{"1.0"}) {
+		t.Fatalf("got tags %v, want [1.0]", tags)
+	}
+	if _, err := client.ImageInfo(ctx, testRepo, "1.0"); err != nil {
+		t.Fatalf("getting image info: %v", err)
+	}
+
+	if _, err := newTestClient(t, srv, testUser, "wrong").TagList(ctx, testRepo); err == nil {
+		t.Fatal("listing tags with a wrong password succeeded")
+	}
+	if _, err := newTestClient(t, srv, "", "").TagList(ctx, testRepo); err == nil {
+		t.Fatal("listing tags anonymously succeeded")
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	reg := newTestRegistry(t)
+	var exchanges atomic.Int32
+	var scopes []string
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != testUser || password != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("service") != "staticreg-test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		exchanges.Add(1)
+		scopes = append(scopes, r.URL.Query()["scope"]...)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"token":      "token-for-" + testUser,
+			"expires_in": 300,
+		})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-for-"+testUser {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="staticreg-test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	})
+	ctx := context.Background()
+
+	client := newTestClient(t, srv, testUser, testPassword)
+	for i := 0; i < 3; i++ {
+		tags, err := client.TagList(ctx, testRepo)
+		if err != nil {
+			t.Fatalf("listing tags: %v", err)
+		}
+		if !slices.Equal(tags, []string{"1.0"}) {
+			t.Fatalf("got tags %v, want [1.0]", tags)
+		}
+	}
+	if _, err := client.Digest(ctx, testRepo, "1.0"); err != nil {
+		t.Fatalf("getting digest: %v", err)
+	}
+	if n := exchanges.Load(); n != 1 {
+		t.Errorf("got %d token exchanges, want the token to be reused", n)
+	}
+	if !slices.Contains(scopes, "repository:"+testRepo+":pull") {
+		t.Errorf("got scopes %v, want a pull scope for %s", scopes, testRepo)
+	}
+
+	if _, err := newTestClient(t, srv, testUser, "wrong").TagList(ctx, testRepo); err == nil {
+		t.Fatal("listing tags with a wrong password succeeded")
+	}
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/seqeralabs/staticreg/pkg/registry"
+)
+
+// DescribeImage returns what is known about the image, or artifact, ref points to.
+// It does not depend on where img comes from so that every backend presents tags the same way.
+func DescribeImage(ctx context.Context, ref name.Reference, img v1.Image) (registry.ImageInfo, error) {
+	raw, err := img.RawManifest()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	m := &manifestWithArtifactType{}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return registry.ImageInfo{}, err
+	}
+	if !isContainerImage(m) {
+		return artifactInfo(ctx, ref, img, m)
+	}
+
+	platform, err := platformData(img, nil)
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	return registry.ImageInfo{
+		Reference:   ref.String(),
+		PullCommand: pullCommand(ref, ""),
+		Digest:      platform.Digest,
+		MediaType:   platform.MediaType,
+		Platforms:   []registry.PlatformData{platform},
+	}, nil
+}
+
+// DescribeIndex returns what is known about the multi-platform index ref points to,
+// an index without container images is described as a generic artifact
+func DescribeIndex(ctx context.Context, ref name.Reference, idx v1.ImageIndex) (registry.ImageInfo, error) {
+	digest, err := idx.Digest()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	mediaType, err := idx.MediaType()
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+
+	info := registry.ImageInfo{
+		Reference:   ref.String(),
+		PullCommand: pullCommand(ref, ""),
+		Digest:      digest.String(),
+		MediaType:   string(mediaType),
+		Index:       true,
+		Platforms:   []registry.PlatformData{},
+	}
+	for _, m := range manifest.Manifests {
+		if !m.MediaType.IsImage() || m.ArtifactType != "" || isAttestation(m) {
+			continue
+		}
+		i, err := idx.Image(m.Digest)
+		if err != nil {
+			return registry.ImageInfo{}, err
+		}
+		platform, err := platformData(i, m.Platform)
+		if err != nil {
+			return registry.ImageInfo{}, err
+		}
+		info.Platforms = append(info.Platforms, platform)
+	}
+	if len(info.Platforms) == 0 {
+		return indexArtifactInfo(ref, idx, manifest)
+	}
+
+	return info, nil
+}
+
+// platformData extracts what is shown about img, the platform comes from the index descriptor
+// when available and from the image configuration otherwise
+func platformData(img v1.Image, platform *v1.Platform) (registry.PlatformData, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return registry.PlatformData{}, err
+	}
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return registry.PlatformData{}, err
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return registry.PlatformData{}, err
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return registry.PlatformData{}, err
+	}
+
+	if platform == nil {
+		platform = cf.Platform()
+	}
+
+	size := manifest.Config.Size
+	for _, l := range manifest.Layers {
+		size += l.Size
+	}
+
+	data := registry.PlatformData{
+		Digest:       digest.String(),
+		MediaType:    string(mediaType),
+		Size:         size,
+		Layers:       len(manifest.Layers),
+		CreatedAt:    cf.Created.Time,
+		Labels:       cf.Config.Labels,
+		Annotations:  manifest.Annotations,
+		Entrypoint:   cf.Config.Entrypoint,
+		Cmd:          cf.Config.Cmd,
+		ExposedPorts: make([]string, 0, len(cf.Config.ExposedPorts)),
+	}
+	for p := range cf.Config.ExposedPorts {
+		data.ExposedPorts = append(data.ExposedPorts, p)
+	}
+	sort.Strings(data.ExposedPorts)
+	if platform != nil {
+		data.Platform = platform.String()
+	}
+	return data, nil
+}
+
+// isAttestation tells if an index entry is a buildkit attestation manifest rather than a runnable image
+func isAttestation(desc v1.Descriptor) bool {
+	if desc.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+		return true
+	}
+	return desc.Platform != nil && desc.Platform.OS == "unknown" && desc.Platform.Architecture == "unknown"
+}
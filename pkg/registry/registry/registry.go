@@ -17,12 +17,16 @@ package registry
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync/atomic"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 
 	"github.com/seqeralabs/staticreg/pkg/cfg"
+	"github.com/seqeralabs/staticreg/pkg/registry"
 )
 
 const defaultUserAgent = "seqera/staticreg"
@@ -32,28 +36,48 @@ var (
 )
 
 type config struct {
-	Registry      string
-	User          string
-	Password      string
-	SkipTLSVerify bool
-	TLSEnabled    bool
+	Registry        string
+	User            string
+	Password        string
+	UseDockerConfig bool
+	TLSEnabled      bool
+	TLS             tlsConfig
+	// RequestsPerSecond limits the rate of requests sent to the registry, zero means unlimited
+	RequestsPerSecond float64
 }
 
 type Registry struct {
 	cfg config
+	// transport carries the TLS configuration and the rate limit of the registry
+	transport http.RoundTripper
+	// keychain provides the credentials ggcr authenticates every request with
+	keychain authn.Keychain
+	// puller is shared by every call so that authenticated transports, and the tokens they
+	// exchanged, are reused until they expire. ggcr remembers the failures of a puller,
+	// so it is replaced by a fresh one whenever a call fails.
+	puller atomic.Pointer[remote.Puller]
+	// nameOpts are used to parse every reference, they make sure the right scheme is used
+	nameOpts []name.Option
 }
 
 func (c *Registry) RepoName(r string) (name.Repository, error) {
-	return name.NewRepository(r, name.WithDefaultRegistry(c.cfg.Registry))
+	return name.NewRepository(r, c.nameOpts...)
 }
 
-func (c *Registry) RepoList(ctx context.Context) ([]string, error) {
-	reg, _ := name.NewRegistry(c.cfg.Registry)
-	repos, err := remote.Catalog(ctx, reg)
+// RepoPage retrieves at most n repository names from the catalog, starting right after the repository named last.
+// An empty last starts from the beginning of the catalog.
+func (c *Registry) RepoPage(ctx context.Context, last string, n int) ([]string, error) {
+	reg, err := name.NewRegistry(c.cfg.Registry, c.nameOpts...)
 	if err != nil {
 		return nil, err
 	}
-	reposret := []string{}
+	repos, err := withPuller(ctx, c, func(opts []remote.Option) ([]string, error) {
+		return remote.CatalogPage(reg, last, n, opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	reposret := make([]string, 0, len(repos))
 	for _, r := range repos {
 		repoName, err := c.RepoName(r)
 		if err != nil {
@@ -65,36 +89,155 @@ func (c *Registry) RepoList(ctx context.Context) ([]string, error) {
 }
 
 func (c *Registry) TagList(ctx context.Context, repo string) ([]string, error) {
-	rname, err := name.NewRepository(repo, name.WithDefaultRegistry(c.cfg.Registry))
+	rname, err := c.RepoName(repo)
 	if err != nil {
 		return nil, err
 	}
-	return remote.List(rname, remote.WithContext(ctx), uaOption)
+	return withPuller(ctx, c, func(opts []remote.Option) ([]string, error) {
+		return remote.List(rname, opts...)
+	})
 }
 
-func (c *Registry) ImageInfo(ctx context.Context, image string, tag string) (v1.Image, string, error) {
-	ref, err := name.ParseReference(fmt.Sprintf("%s/%s:%s", c.cfg.Registry, image, tag))
+func (c *Registry) ImageInfo(ctx context.Context, image string, tag string) (registry.ImageInfo, error) {
+	ref, err := name.ParseReference(fmt.Sprintf("%s/%s:%s", c.cfg.Registry, image, tag), c.nameOpts...)
+	if err != nil {
+		return registry.ImageInfo{}, err
+	}
+	return withPuller(ctx, c, func(opts []remote.Option) (registry.ImageInfo, error) {
+		desc, err := remote.Get(ref, opts...)
+		if err != nil {
+			return registry.ImageInfo{}, err
+		}
+
+		if desc.MediaType.IsIndex() {
+			idx, err := desc.ImageIndex()
+			if err != nil {
+				return registry.ImageInfo{}, err
+			}
+			return DescribeIndex(ctx, ref, idx)
+		}
+		img, err := desc.Image()
+		if err != nil {
+			return registry.ImageInfo{}, err
+		}
+		return DescribeImage(ctx, ref, img)
+	})
+}
+
+// Digest retrieves the digest of the manifest a tag points to with a HEAD request,
+// which is much cheaper than fetching the manifest and does not count against most registries rate limits
+func (c *Registry) Digest(ctx context.Context, image string, tag string) (string, error) {
+	ref, err := name.ParseReference(fmt.Sprintf("%s/%s:%s", c.cfg.Registry, image, tag), c.nameOpts...)
+	if err != nil {
+		return "", err
+	}
+	return withPuller(ctx, c, func(opts []remote.Option) (string, error) {
+		desc, err := remote.Head(ref, opts...)
+		if err != nil {
+			return "", err
+		}
+		return desc.Digest.String(), nil
+	})
+}
+
+// Referrers retrieves the artifacts attached to the image with the given digest, using the referrers API
+// and falling back to the referrers tag schema for registries that do not support it
+func (c *Registry) Referrers(ctx context.Context, image string, digest string) ([]registry.Referrer, error) {
+	ref, err := name.NewDigest(fmt.Sprintf("%s/%s@%s", c.cfg.Registry, image, digest), c.nameOpts...)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := withPuller(ctx, c, func(opts []remote.Option) (*v1.IndexManifest, error) {
+		idx, err := remote.Referrers(ref, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return idx.IndexManifest()
+	})
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	i, err := remote.Image(ref, remote.WithContext(ctx), uaOption)
+
+	referrers := make([]registry.Referrer, 0, len(manifest.Manifests))
+	for _, m := range manifest.Manifests {
+		artifactType := m.ArtifactType
+		if artifactType == "" {
+			artifactType = string(m.MediaType)
+		}
+		referrers = append(referrers, registry.Referrer{
+			ArtifactType: artifactType,
+			Digest:       m.Digest.String(),
+			MediaType:    string(m.MediaType),
+			Size:         m.Size,
+			Annotations:  m.Annotations,
+		})
+	}
+	return referrers, nil
+}
+
+// withPuller runs op with the options shared by every remote call against the registry,
+// the shared puller is replaced when op fails
+func withPuller[T any](ctx context.Context, c *Registry, op func(opts []remote.Option) (T, error)) (T, error) {
+	p := c.puller.Load()
+	v, err := op([]remote.Option{
+		remote.WithContext(ctx),
+		remote.Reuse(p),
+	})
 	if err != nil {
-		return nil, "", err
+		if fresh, perr := c.newPuller(); perr == nil {
+			c.puller.CompareAndSwap(p, fresh)
+		}
 	}
+	return v, err
+}
 
-	return i, ref.String(), nil
+// newPuller returns a puller authenticating with the keychain of the registry.
+// Failed responses are not retried by ggcr, the crawler owns retries.
+func (c *Registry) newPuller() (*remote.Puller, error) {
+	return remote.NewPuller(
+		remote.WithTransport(c.transport),
+		remote.WithAuthFromKeychain(c.keychain),
+		remote.WithRetryStatusCodes(),
+		uaOption,
+	)
 }
 
-func New(rootCfg *cfg.Root) *Registry {
+func New(regCfg *cfg.Registry) (*Registry, error) {
 	cfg := config{
-		Registry:      rootCfg.RegistryHostname,
-		User:          rootCfg.RegistryUser,
-		Password:      rootCfg.RegistryPassword,
-		TLSEnabled:    rootCfg.TLSEnabled,
-		SkipTLSVerify: rootCfg.SkipTLSVerify,
+		Registry:        regCfg.Hostname,
+		User:            regCfg.User,
+		Password:        regCfg.Password,
+		UseDockerConfig: regCfg.UseDockerConfig,
+		TLSEnabled:      regCfg.TLSEnabled,
+		TLS: tlsConfig{
+			SkipTLSVerify: regCfg.SkipTLSVerify,
+			CAPaths:       regCfg.TLSCAPaths,
+			ClientCert:    regCfg.TLSClientCert,
+			ClientKey:     regCfg.TLSClientKey,
+		},
+		RequestsPerSecond: regCfg.RequestsPerSecond,
+	}
+
+	tlsTransport, err := newTLSTransport(cfg.TLS)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Registry{
-		cfg: cfg,
+	nameOpts := []name.Option{name.WithDefaultRegistry(cfg.Registry)}
+	if !cfg.TLSEnabled {
+		nameOpts = append(nameOpts, name.Insecure)
+	}
+
+	r := &Registry{
+		cfg:       cfg,
+		transport: newThrottleTransport(tlsTransport, cfg.RequestsPerSecond),
+		keychain:  newKeychain(cfg.User, cfg.Password, cfg.UseDockerConfig),
+		nameOpts:  nameOpts,
+	}
+	puller, err := r.newPuller()
+	if err != nil {
+		return nil, err
 	}
+	r.puller.Store(puller)
+	return r, nil
 }
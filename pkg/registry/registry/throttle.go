@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+)
+
+const (
+	// maxThrottledRetries is how many times a request answered with 429 is retried before giving up
+	maxThrottledRetries = 5
+	// defaultRetryAfter is used when a 429 response does not carry a usable Retry-After header
+	defaultRetryAfter = 10 * time.Second
+	// maxRetryAfter caps how long we are willing to wait because of a single Retry-After header
+	maxRetryAfter = 5 * time.Minute
+)
+
+// throttleTransport is an http.RoundTripper that limits the rate of requests sent to the registry
+// and honors 429 Too Many Requests responses. A Retry-After header pauses every request, not just
+// the throttled one, so that the whole crawler slows down instead of hammering the registry.
+type throttleTransport struct {
+	inner   http.RoundTripper
+	limiter *rate.Limiter
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+	now          func() time.Time
+}
+
+// newThrottleTransport creates a throttleTransport allowing at most requestsPerSecond requests,
+// zero or less means no rate limit, only 429 responses are handled then
+func newThrottleTransport(inner http.RoundTripper, requestsPerSecond float64) *throttleTransport {
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if requestsPerSecond > 0 {
+		burst := int(requestsPerSecond)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+	}
+	return &throttleTransport{
+		inner:   inner,
+		limiter: limiter,
+		now:     time.Now,
+	}
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if err := t.waitBlocked(req); err != nil {
+			return nil, err
+		}
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		out := req
+		if attempt > 0 {
+			retry, err := rewindRequest(req)
+			if err != nil {
+				return nil, err
+			}
+			out = retry
+		}
+
+		resp, err := t.inner.RoundTrip(out)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= maxThrottledRetries {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, nil
+		}
+
+		wait := retryAfter(resp.Header.Get("Retry-After"), t.now())
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		t.block(wait)
+		if log := logger.FromContext(ctx); log != nil {
+			log.Warn("registry is throttling requests, slowing down",
+				slog.String("url", req.URL.Redacted()),
+				slog.Duration("retry-after", wait),
+				slog.Int("attempt", attempt+1),
+			)
+		}
+	}
+}
+
+// waitBlocked waits until a pause requested through Retry-After is over
+func (t *throttleTransport) waitBlocked(req *http.Request) error {
+	t.mu.Lock()
+	wait := t.blockedUntil.Sub(t.now())
+	t.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+func (t *throttleTransport) block(wait time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until := t.now().Add(wait)
+	if until.After(t.blockedUntil) {
+		t.blockedUntil = until
+	}
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(header string, now time.Time) time.Duration {
+	wait := defaultRetryAfter
+	if header != "" {
+		if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+			wait = time.Duration(secs) * time.Second
+		} else if at, err := http.ParseTime(header); err == nil {
+			wait = at.Sub(now)
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return min(wait, maxRetryAfter)
+}
+
+var errBodyNotReplayable = errors.New("request body can't be replayed")
+
+// rewindRequest returns a copy of req with a fresh body so that it can be sent again
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	out := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return out, nil
+	}
+	if req.GetBody == nil {
+		return nil, errBodyNotReplayable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	out.Body = body
+	return out, nil
+}
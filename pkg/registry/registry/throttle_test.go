@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// throttlingServer answers 429 to the first throttled requests, then echoes the request body
+func throttlingServer(t *testing.T, throttled int32) (*httptest.Server, *atomic.Int32) {
+	calls := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= throttled {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = io.Copy(w, r.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, calls
+}
+
+func TestThrottleTransportRetries(t *testing.T) {
+	srv, calls := throttlingServer(t, 2)
+	client := &http.Client{Transport: newThrottleTransport(http.DefaultTransport, 0)}
+
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Errorf("got %d %q, want the body sent again once throttling is over", resp.StatusCode, body)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("sent %d requests, want 3", got)
+	}
+}
+
+func TestThrottleTransportGivesUp(t *testing.T) {
+	srv, calls := throttlingServer(t, 100)
+	client := &http.Client{Transport: newThrottleTransport(http.DefaultTransport, 0)}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got %d, want the last 429", resp.StatusCode)
+	}
+	if got := calls.Load(); got != maxThrottledRetries+1 {
+		t.Errorf("sent %d requests, want %d", got, maxThrottledRetries+1)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              defaultRetryAfter,
+		"garbage":                       defaultRetryAfter,
+		"-3":                            defaultRetryAfter,
+		"0":                             0,
+		"30":                            30 * time.Second,
+		"86400":                         maxRetryAfter,
+		"Sat, 01 Jun 2024 12:00:20 GMT": 20 * time.Second,
+		"Sat, 01 Jun 2024 11:59:00 GMT": 0,
+	}
+	for header, want := range tests {
+		if got := retryAfter(header, now); got != want {
+			t.Errorf("retryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
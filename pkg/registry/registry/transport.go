@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+)
+
+// tlsReloadCheckInterval is how often the TLS files are checked for changes
+const tlsReloadCheckInterval = 30 * time.Second
+
+var (
+	ErrNoCertificates       = errors.New("no certificates found")
+	ErrIncompleteClientCert = errors.New("both a client certificate and a client key are required")
+)
+
+type tlsConfig struct {
+	SkipTLSVerify bool
+	// CAPaths are PEM files, or directories containing PEM files, with CAs to trust in addition to the system ones
+	CAPaths []string
+	// ClientCert and ClientKey are a PEM encoded certificate/key pair used for mutual TLS
+	ClientCert string
+	ClientKey  string
+}
+
+// tlsTransport is an http.RoundTripper with a TLS configuration built from files on disk.
+// The files are checked periodically and the underlying http.Transport is rebuilt
+// whenever one of them changes, so that rotated CAs and client certificates are picked
+// up without a restart.
+type tlsTransport struct {
+	cfg tlsConfig
+
+	current     atomic.Pointer[http.Transport]
+	fingerprint string
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	now       func() time.Time
+}
+
+func newTLSTransport(cfg tlsConfig) (*tlsTransport, error) {
+	if (cfg.ClientCert == "") != (cfg.ClientKey == "") {
+		return nil, ErrIncompleteClientCert
+	}
+
+	t := &tlsTransport{
+		cfg: cfg,
+		now: time.Now,
+	}
+
+	fingerprint, err := t.filesFingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	tr, err := t.build()
+	if err != nil {
+		return nil, err
+	}
+
+	t.current.Store(tr)
+	t.fingerprint = fingerprint
+	t.lastCheck = t.now()
+	return t, nil
+}
+
+func (t *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.maybeReload(req)
+	return t.current.Load().RoundTrip(req)
+}
+
+// maybeReload rebuilds the transport if the TLS files changed since the last check.
+// A failure keeps the previous transport in place, it will be tried again at the next check.
+func (t *tlsTransport) maybeReload(req *http.Request) {
+	if len(t.cfg.CAPaths) == 0 && t.cfg.ClientCert == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.now().Sub(t.lastCheck) < tlsReloadCheckInterval {
+		return
+	}
+	t.lastCheck = t.now()
+
+	log := logger.FromContext(req.Context())
+
+	fingerprint, err := t.filesFingerprint()
+	if err != nil {
+		if log != nil {
+			log.Warn("could not check TLS files for changes", logger.ErrAttr(err))
+		}
+		return
+	}
+	if fingerprint == t.fingerprint {
+		return
+	}
+
+	tr, err := t.build()
+	if err != nil {
+		if log != nil {
+			log.Warn("could not reload TLS configuration, keeping the previous one", logger.ErrAttr(err))
+		}
+		return
+	}
+
+	old := t.current.Swap(tr)
+	old.CloseIdleConnections()
+	t.fingerprint = fingerprint
+
+	if log != nil {
+		log.Info("reloaded TLS configuration", slog.Any("ca-paths", t.cfg.CAPaths), slog.String("client-cert", t.cfg.ClientCert))
+	}
+}
+
+func (t *tlsTransport) build() (*http.Transport, error) {
+	tr := remote.DefaultTransport.(*http.Transport).Clone()
+
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.cfg.SkipTLSVerify,
+	}
+
+	if len(t.cfg.CAPaths) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, p := range t.cfg.CAPaths {
+			if err := appendCAs(pool, p); err != nil {
+				return nil, err
+			}
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if t.cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(t.cfg.ClientCert, t.cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	tr.TLSClientConfig = tlsCfg
+	return tr, nil
+}
+
+// filesFingerprint summarizes name, size and modification time of every TLS file in use
+func (t *tlsTransport) filesFingerprint() (string, error) {
+	files := []string{}
+	for _, p := range t.cfg.CAPaths {
+		caFiles, err := caFiles(p)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, caFiles...)
+	}
+	if t.cfg.ClientCert != "" {
+		files = append(files, t.cfg.ClientCert, t.cfg.ClientKey)
+	}
+
+	var sb strings.Builder
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d;", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// caFiles returns p itself if it is a file, or the regular files it contains if it is a directory
+func caFiles(p string) ([]string, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{p}, nil
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(p, e.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func appendCAs(pool *x509.CertPool, p string) error {
+	files, err := caFiles(p)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, f := range files {
+		pem, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if pool.AppendCertsFromPEM(pem) {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w in %s", ErrNoCertificates, p)
+	}
+	return nil
+}
@@ -16,5 +16,6 @@ package errors
 
 import "errors"
 
+var ErrRegistryNotFound = errors.New("registry not found")
 var ErrRepositoryNotFound = errors.New("repository not found")
 var ErrSlugTooShort = errors.New("slug too short")
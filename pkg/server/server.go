@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
+	"expvar"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -22,19 +24,27 @@ type Server struct {
 }
 
 type ServerImpl interface {
+	IndexHandler(ctx *gin.Context)
 	RepositoriesListHandler(ctx *gin.Context)
 	RepositoryHandler(ctx *gin.Context)
 	NotFoundHandler(ctx *gin.Context)
 	NoRouteHandler(ctx *gin.Context)
 	InternalServerErrorHandler(ctx *gin.Context)
+	RegistryWebhookHandler(ctx *gin.Context)
+	StatusHandler(ctx *gin.Context)
+	StatusJSONHandler(ctx *gin.Context)
+	HealthzHandler(ctx *gin.Context)
+	ReadyzHandler(ctx *gin.Context)
 }
 
 func New(
 	bindAddr string,
 	serverImpl ServerImpl,
 	log *slog.Logger,
+	store persist.CacheStore,
 	cacheDuration time.Duration,
 	ignoredUserAgents []string,
+	webhookSecret string,
 ) (*Server, error) {
 	gin.SetMode(gin.ReleaseMode)
 
@@ -51,7 +61,6 @@ func New(
 
 	r.Use(sloggin.NewWithConfig(log, lmConfig))
 	r.Use(gin.Recovery())
-	store := persist.NewMemoryStore(cacheDuration)
 	r.Use(injectLoggerMiddleware(log))
 	r.NoRoute(serverImpl.NoRouteHandler)
 	r.Use(serverImpl.NotFoundHandler)
@@ -63,13 +72,29 @@ func New(
 		staticRouter.StaticFS("/", http.FS(static.Assets))
 	}
 
+	r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+
+	// probes are registered before the user agent filter, kube-probe must get a real answer
+	r.GET("/healthz", serverImpl.HealthzHandler)
+	r.GET("/readyz", serverImpl.ReadyzHandler)
+
+	// registries notify from their own user agent, the endpoint is only enabled with a secret to check them against
+	if webhookSecret != "" {
+		r.POST("/hooks/registry", sharedSecretMiddleware(webhookSecret), serverImpl.RegistryWebhookHandler)
+	}
+
 	ignoredUAMiddleware := ignoreUserAgentMiddleware(ignoredUserAgents)
 
 	r.Use(ignoredUAMiddleware)
 	htmlRoutes := r.Group("/")
 	{
-		r.GET("/", cache.CacheByRequestURI(store, cacheDuration), serverImpl.RepositoriesListHandler)
+		r.GET("/", cache.CacheByRequestURI(store, cacheDuration), serverImpl.IndexHandler)
 		r.GET("/repo/*slug", cache.CacheByRequestURI(store, cacheDuration), serverImpl.RepositoryHandler)
+		r.GET("/r/:registry/", cache.CacheByRequestURI(store, cacheDuration), serverImpl.RepositoriesListHandler)
+		r.GET("/r/:registry/repo/*slug", cache.CacheByRequestURI(store, cacheDuration), serverImpl.RepositoryHandler)
+		// the status is never cached, it is what tells how fresh the cached pages are
+		r.GET("/status", serverImpl.StatusHandler)
+		r.GET("/status.json", serverImpl.StatusJSONHandler)
 	}
 	htmlRoutes.Use(htmlContentTypeMiddleware)
 
@@ -119,6 +144,23 @@ func ignoreUserAgentMiddleware(ignoredUserAgents []string) gin.HandlerFunc {
 	}
 }
 
+// sharedSecretMiddleware rejects requests without the secret in the Authorization header,
+// either as a bearer token or as the raw header value as sent by Harbor
+func sharedSecretMiddleware(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		token, isBearer := strings.CutPrefix(auth, "Bearer ")
+		if !isBearer {
+			token = auth
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
 func cacheControlMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Cache-Control", "public, max-age=604800, immutable")
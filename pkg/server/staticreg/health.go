@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package staticreg
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	checkSynchronized = "synchronized"
+	checkUpstream     = "upstream"
+)
+
+// check is the outcome of a readiness check, for a single registry
+type check struct {
+	Name     string `json:"name"`
+	Registry string `json:"registry"`
+	OK       bool   `json:"ok"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// HealthzHandler tells that the process is alive and serving requests
+func (s *StaticregServer) HealthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ReadyzHandler tells if every registry has data to serve and can be reached,
+// it replies 503 with the failing checks otherwise
+func (s *StaticregServer) ReadyzHandler(c *gin.Context) {
+	checks := []check{}
+	ready := true
+	for _, reg := range s.ordered {
+		for _, chk := range s.readinessChecks(reg) {
+			ready = ready && chk.OK
+			checks = append(checks, chk)
+		}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "failing", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
+
+func (s *StaticregServer) readinessChecks(reg *Registry) []check {
+	synchronized := check{
+		Name:     checkSynchronized,
+		Registry: reg.Name,
+		OK:       reg.Crawler.Synchronized(),
+	}
+	if !synchronized.OK {
+		synchronized.Detail = "first synchronization in progress"
+	}
+
+	// the registry may fail for a while, what was synchronized before is still served meanwhile
+	health := reg.Crawler.Health()
+	upstream := check{
+		Name:     checkUpstream,
+		Registry: reg.Name,
+		OK:       health.LastError == nil || time.Since(health.LastSyncedAt) < s.readyThreshold,
+	}
+	if health.LastError != nil {
+		upstream.Detail = health.LastError.Error()
+		if !health.LastSyncedAt.IsZero() {
+			upstream.Detail = fmt.Sprintf("%s, last reached at %s", upstream.Detail, health.LastSyncedAt.Format(time.RFC3339))
+		}
+	}
+
+	return []check{synchronized, upstream}
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package staticreg
+
+import (
+	"context"
+	"log/slog"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+)
+
+// invalidationQueueSize bounds the changes waiting for their pages to be invalidated,
+// the pages of the changes that are missed are served from the cache until they expire
+const invalidationQueueSize = 1024
+
+// InvalidateOnChanges removes the cached pages of the repositories the crawlers notice changes in, until ctx is done
+func (s *StaticregServer) InvalidateOnChanges(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+	for _, reg := range s.ordered {
+		sub := reg.Crawler.Subscribe("cache-invalidation", invalidationQueueSize)
+		log := logger.FromContext(ctx).With(slog.String("registry", reg.Name))
+		g.Go(func() error {
+			defer sub.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case e := <-sub.Events():
+					log.Debug("invalidating pages", slog.Any("event", e))
+					s.invalidate(s.repositoryPaths(reg, e.Repository))
+				}
+			}
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package staticreg
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chenyahui/gin-cache/persist"
+	"github.com/gin-gonic/gin"
+
+	"github.com/seqeralabs/staticreg/pkg/filler"
+	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/async"
+	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+)
+
+// emptyClient knows no repository
+type emptyClient struct {
+	registry.Client
+}
+
+func (emptyClient) TagList(context.Context, string) ([]string, error) {
+	return nil, errs.ErrNotFound
+}
+
+// fetchCrawler answers on-demand fetches with err
+type fetchCrawler struct {
+	Crawler
+	err     error
+	fetched []string
+}
+
+func (f *fetchCrawler) Fetch(_ context.Context, repo string) error {
+	f.fetched = append(f.fetched, repo)
+	return f.err
+}
+
+func TestRepositoryFetch(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "not found", status: http.StatusNotFound},
+		{name: "excluded", err: async.ErrRepositoryExcluded, status: http.StatusNotFound},
+		{name: "rate limited", err: async.ErrTooManyFetches, status: http.StatusServiceUnavailable},
+		{name: "slow", err: context.DeadlineExceeded, status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crawler := &fetchCrawler{err: tt.err}
+			s := New([]*Registry{{
+				Name:       "registry.example.com",
+				Hostname:   "registry.example.com",
+				DataFiller: filler.New(emptyClient{}, "registry.example.com", "/", "/"),
+				Crawler:    crawler,
+			}}, "/", persist.NewMemoryStore(time.Minute), time.Second, 0)
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("logger", slog.New(slog.NewTextHandler(io.Discard, nil)))
+			})
+			r.GET("/repo/*slug", s.RepositoryHandler)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/repo/team/app", nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("got status %d, want %d", rec.Code, tt.status)
+			}
+			if len(crawler.fetched) != 1 || crawler.fetched[0] != "team/app" {
+				t.Errorf("fetched %v", crawler.fetched)
+			}
+			if tt.status == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+				t.Error("indexing page without Retry-After")
+			}
+		})
+	}
+}
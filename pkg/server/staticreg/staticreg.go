@@ -16,47 +16,191 @@ package staticreg
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/chenyahui/gin-cache/persist"
 	"github.com/gin-gonic/gin"
 
 	"github.com/seqeralabs/staticreg/pkg/filler"
 	"github.com/seqeralabs/staticreg/pkg/observability/logger"
 	"github.com/seqeralabs/staticreg/pkg/registry"
+	"github.com/seqeralabs/staticreg/pkg/registry/async"
 	"github.com/seqeralabs/staticreg/pkg/registry/errs"
+	"github.com/seqeralabs/staticreg/pkg/registry/events"
 	"github.com/seqeralabs/staticreg/pkg/templates"
 
 	servererrors "github.com/seqeralabs/staticreg/pkg/server/errors"
 )
 
+// siteName is shown as the title of the pages that are not about a specific registry
+const siteName = "staticreg"
+
+// indexingRefreshSeconds is how often the page of a repository being indexed reloads itself
+const indexingRefreshSeconds = 5
+
+// Registry is a registry served by staticreg
+type Registry struct {
+	Name       string
+	Hostname   string
+	RegClient  registry.Client
+	DataFiller *filler.Filler
+	Crawler    Crawler
+}
+
+// Crawler is the process that keeps the registry data up to date
+type Crawler interface {
+	// Health reports the outcome of the last synchronization
+	Health() async.Health
+	// Synchronized tells if a full synchronization completed or a saved state was loaded
+	Synchronized() bool
+	// Status describes the synchronization in progress, the last one and what failed to synchronize
+	Status() async.Status
+	// Refresh schedules the synchronization of a tag, or of a whole repository when tag is empty
+	Refresh(ctx context.Context, repo string, tag string, onComplete func()) error
+	// Fetch synchronizes a repository right away and waits until it is done or ctx expires
+	Fetch(ctx context.Context, repo string) error
+	DeleteTag(repo string, tag string)
+	DeleteDigest(repo string, digest string) []string
+	DeleteRepository(repo string)
+	// Subscribe creates a subscription to the changes noticed while synchronizing
+	Subscribe(name string, size int) *events.Subscription
+}
+
 type StaticregServer struct {
-	regClient        registry.Client
-	dataFiller       *filler.Filler
-	registryHostname string
+	registries map[string]*Registry
+	// ordered keeps the registries in the order they were configured
+	ordered []*Registry
+	rootDir string
+	// cache holds the rendered pages, entries are removed when registry notifications or the crawlers change them
+	cache persist.CacheStore
+	// fetchTimeout is how long to wait for a repository that is not synchronized yet to be fetched
+	// before showing that it is being indexed, zero disables on-demand fetches
+	fetchTimeout time.Duration
+	// readyThreshold is how long registries can fail to synchronize before staticreg is not ready anymore
+	readyThreshold time.Duration
 }
 
 func New(
-	regClient registry.Client,
-	dataFiller *filler.Filler,
-	registryHostname string,
+	registries []*Registry,
+	rootDir string,
+	cache persist.CacheStore,
+	fetchTimeout time.Duration,
+	readyThreshold time.Duration,
 ) *StaticregServer {
+	byName := make(map[string]*Registry, len(registries))
+	for _, r := range registries {
+		byName[r.Name] = r
+	}
 	return &StaticregServer{
-		regClient:        regClient,
-		dataFiller:       dataFiller,
-		registryHostname: registryHostname,
+		registries:     byName,
+		ordered:        registries,
+		rootDir:        rootDir,
+		cache:          cache,
+		fetchTimeout:   fetchTimeout,
+		readyThreshold: readyThreshold,
+	}
+}
+
+// registry returns the registry addressed by the request, requests without
+// a registry parameter address the only registry when there is just one
+func (s *StaticregServer) registry(c *gin.Context) (*Registry, bool) {
+	name := c.Param("registry")
+	if name == "" {
+		if len(s.ordered) == 1 {
+			return s.ordered[0], true
+		}
+		return nil, false
+	}
+	reg, ok := s.registries[name]
+	return reg, ok
+}
+
+// baseData returns the data for the registry addressed by the request, or the site wide data
+func (s *StaticregServer) baseData(c *gin.Context) templates.BaseData {
+	if reg, ok := s.registry(c); ok {
+		return reg.DataFiller.BaseData()
+	}
+	return templates.BaseData{
+		RootDir:      s.rootDir,
+		AbsoluteDir:  s.rootDir,
+		RegistryName: siteName,
+		LastUpdated:  time.Now().Format(time.RFC3339),
+	}
+}
+
+// IndexHandler shows the repositories of the registry when there is only one, or the list of registries
+func (s *StaticregServer) IndexHandler(c *gin.Context) {
+	if len(s.ordered) == 1 {
+		s.renderRepositoriesList(c, s.ordered[0])
+		return
+	}
+	s.RegistriesListHandler(c)
+}
+
+func (s *StaticregServer) RegistriesListHandler(c *gin.Context) {
+	baseData := s.baseData(c)
+	registriesData := make([]templates.RegistryData, 0, len(s.ordered))
+	for _, reg := range s.ordered {
+		rdata := templates.RegistryData{
+			Name:        reg.Name,
+			Hostname:    reg.Hostname,
+			AbsoluteDir: reg.DataFiller.BaseData().AbsoluteDir,
+		}
+		health := reg.Crawler.Health()
+		switch {
+		case health.LastError != nil:
+			rdata.Status = "failing"
+			rdata.Error = health.LastError.Error()
+		case health.LastSyncedAt.IsZero():
+			rdata.Status = "synchronizing"
+		default:
+			rdata.Status = "ok"
+		}
+		if !health.LastSyncedAt.IsZero() {
+			rdata.LastSyncedAt = health.LastSyncedAt.Format(time.RFC3339)
+		}
+		registriesData = append(registriesData, rdata)
+	}
+
+	var buf bytes.Buffer
+	err := templates.RenderRegistries(&buf, templates.RegistriesData{
+		BaseData:   baseData,
+		Registries: registriesData,
+	})
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+	_, err = buf.WriteTo(c.Writer)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 }
 
 func (s *StaticregServer) RepositoriesListHandler(c *gin.Context) {
+	reg, ok := s.registry(c)
+	if !ok {
+		_ = c.AbortWithError(http.StatusNotFound, servererrors.ErrRegistryNotFound)
+		return
+	}
+	s.renderRepositoriesList(c, reg)
+}
+
+func (s *StaticregServer) renderRepositoriesList(c *gin.Context, reg *Registry) {
 	repositoriesData := []templates.IndexRepositoryData{}
-	baseData := s.dataFiller.BaseData()
+	baseData := reg.DataFiller.BaseData()
 
-	repos, err := s.regClient.RepoList(c)
+	repos, err := reg.RegClient.RepoList(c)
 	if err != nil {
 		_ = c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -79,7 +223,11 @@ func (s *StaticregServer) RepositoriesListHandler(c *gin.Context) {
 			BaseData:       baseData,
 			RepositoryName: repo.Name,
 			PullReference:  repo.PullReference,
-			LastUpdatedAt:  repo.LastUpdatedAt.Format(time.RFC3339),
+			PullCommand:    repo.PullCommand,
+		}
+		// repositories whose tags are all left out by the tag policy have no known date
+		if !repo.LastUpdatedAt.IsZero() {
+			idata.LastUpdatedAt = repo.LastUpdatedAt.Format(time.RFC3339)
 		}
 		repositoriesData = append(repositoriesData, idata)
 	}
@@ -104,6 +252,11 @@ func (s *StaticregServer) RepositoriesListHandler(c *gin.Context) {
 }
 
 func (s *StaticregServer) RepositoryHandler(c *gin.Context) {
+	reg, ok := s.registry(c)
+	if !ok {
+		_ = c.AbortWithError(http.StatusNotFound, servererrors.ErrRegistryNotFound)
+		return
+	}
 
 	slug := c.Param("slug")
 
@@ -114,7 +267,16 @@ func (s *StaticregServer) RepositoryHandler(c *gin.Context) {
 
 	slug = strings.TrimLeft(slug, "/")
 
-	repoData, err := s.dataFiller.RepoData(c, slug)
+	repoData, err := reg.DataFiller.RepoData(c, slug)
+	if err == nil && repoData == nil && s.fetchTimeout > 0 {
+		// the crawler might just not have reached the repository yet
+		repoData, err = s.fetchRepository(c, reg, slug)
+		// a repository that is not fetched because of the rate limit might still exist
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, async.ErrTooManyFetches) {
+			s.renderIndexing(c, reg, slug)
+			return
+		}
+	}
 	if err != nil {
 		if errors.Is(err, errs.ErrInvalidReference) {
 			_ = c.AbortWithError(http.StatusNotFound, err)
@@ -143,6 +305,42 @@ func (s *StaticregServer) RepositoryHandler(c *gin.Context) {
 	}
 }
 
+// fetchRepository synchronizes repo right away and returns its data, nil if it does not exist
+func (s *StaticregServer) fetchRepository(c *gin.Context, reg *Registry, repo string) (*templates.RepositoryData, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.fetchTimeout)
+	defer cancel()
+	err := reg.Crawler.Fetch(ctx, repo)
+	if errors.Is(err, async.ErrRepositoryExcluded) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reg.DataFiller.RepoData(c, repo)
+}
+
+// renderIndexing tells that repo is being synchronized, the page is not cached and reloads itself
+func (s *StaticregServer) renderIndexing(c *gin.Context, reg *Registry, repo string) {
+	var buf bytes.Buffer
+	err := templates.RenderIndexing(&buf, templates.IndexingData{
+		BaseData:       reg.DataFiller.BaseData(),
+		RepositoryName: repo,
+		RefreshSeconds: indexingRefreshSeconds,
+	})
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("Retry-After", strconv.Itoa(indexingRefreshSeconds))
+	c.Status(http.StatusServiceUnavailable)
+	_, err = buf.WriteTo(c.Writer)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+}
+
 func (s *StaticregServer) NotFoundHandler(c *gin.Context) {
 	c.Next()
 	if len(c.Errors) == 0 {
@@ -152,7 +350,7 @@ func (s *StaticregServer) NotFoundHandler(c *gin.Context) {
 	if c.Writer.Status() != http.StatusNotFound {
 		return
 	}
-	baseData := s.dataFiller.BaseData()
+	baseData := s.baseData(c)
 
 	var buf bytes.Buffer
 	err := templates.Render404(&buf, baseData)
@@ -187,7 +385,7 @@ func (s *StaticregServer) InternalServerErrorHandler(c *gin.Context) {
 		return
 	}
 
-	baseData := s.dataFiller.BaseData()
+	baseData := s.baseData(c)
 
 	err := templates.Render500(c.Writer, baseData)
 	if err != nil {
@@ -198,7 +396,7 @@ func (s *StaticregServer) InternalServerErrorHandler(c *gin.Context) {
 }
 
 func (s *StaticregServer) NoRouteHandler(c *gin.Context) {
-	baseData := s.dataFiller.BaseData()
+	baseData := s.baseData(c)
 
 	err := templates.Render404(c.Writer, baseData)
 	if err != nil {
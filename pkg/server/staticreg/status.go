@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package staticreg
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/seqeralabs/staticreg/pkg/registry/async"
+	"github.com/seqeralabs/staticreg/pkg/templates"
+)
+
+// registryStatus is the status of a registry as served by the JSON endpoint
+type registryStatus struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	async.Status
+}
+
+// StatusHandler shows how the synchronization of every registry is going
+func (s *StaticregServer) StatusHandler(c *gin.Context) {
+	registries := make([]templates.RegistryStatusData, 0, len(s.ordered))
+	for _, reg := range s.ordered {
+		status := reg.Crawler.Status()
+		data := templates.RegistryStatusData{
+			Name:        reg.Name,
+			Hostname:    reg.Hostname,
+			AbsoluteDir: reg.DataFiller.BaseData().AbsoluteDir,
+			Phase:       string(status.Phase),
+			LastError:   status.LastError,
+			Current:     syncStatsData(status.Current),
+			LastSync:    syncStatsData(status.LastSync),
+			Errors:      make([]templates.ItemErrorData, 0, len(status.Errors)),
+			Retries:     make([]templates.RetryData, 0, len(status.Retries)),
+			DeadLetters: make([]templates.DeadLetterData, 0, len(status.DeadLetters)),
+		}
+		for _, e := range status.Errors {
+			data.Errors = append(data.Errors, templates.ItemErrorData{
+				Repository: e.Repository,
+				Tag:        e.Tag,
+				Error:      e.Error,
+				At:         e.At.Format(time.RFC3339),
+			})
+		}
+		for _, r := range status.Retries {
+			next := "in progress"
+			if !r.NextAt.IsZero() {
+				next = r.NextAt.Format(time.RFC3339)
+			}
+			data.Retries = append(data.Retries, templates.RetryData{
+				Repository: r.Repository,
+				Tag:        r.Tag,
+				Attempts:   r.Attempts,
+				Error:      r.Error,
+				NextAt:     next,
+			})
+		}
+		for _, d := range status.DeadLetters {
+			data.DeadLetters = append(data.DeadLetters, templates.DeadLetterData{
+				Repository: d.Repository,
+				Tag:        d.Tag,
+				Attempts:   d.Attempts,
+				Permanent:  d.Permanent,
+				Error:      d.Error,
+				At:         d.At.Format(time.RFC3339),
+			})
+		}
+		registries = append(registries, data)
+	}
+
+	var buf bytes.Buffer
+	err := templates.RenderStatus(&buf, templates.StatusData{
+		BaseData:   s.baseData(c),
+		Registries: registries,
+	})
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	_, err = buf.WriteTo(c.Writer)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+}
+
+// StatusJSONHandler serves the same data as StatusHandler for monitoring tools
+func (s *StaticregServer) StatusJSONHandler(c *gin.Context) {
+	registries := make([]registryStatus, 0, len(s.ordered))
+	for _, reg := range s.ordered {
+		registries = append(registries, registryStatus{
+			Name:     reg.Name,
+			Hostname: reg.Hostname,
+			Status:   reg.Crawler.Status(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"registries": registries})
+}
+
+func syncStatsData(stats *async.SyncStats) *templates.SyncStatsData {
+	if stats == nil {
+		return nil
+	}
+	data := &templates.SyncStatsData{
+		Generation:           stats.Generation,
+		StartedAt:            stats.StartedAt.Format(time.RFC3339),
+		Repositories:         stats.Repositories,
+		RepositoriesFailed:   stats.RepositoriesFailed,
+		RepositoriesExcluded: stats.RepositoriesExcluded,
+		TagsUnchanged:        stats.TagsUnchanged,
+		TagsUpdated:          stats.TagsUpdated,
+		TagsNew:              stats.TagsNew,
+		TagsFailed:           stats.TagsFailed,
+		TagsUntracked:        stats.TagsUntracked,
+		RepositoriesEvicted:  stats.RepositoriesEvicted,
+		TagsEvicted:          stats.TagsEvicted,
+	}
+	if stats.FinishedAt.IsZero() {
+		data.Duration = time.Since(stats.StartedAt).Round(time.Second).String()
+	} else {
+		data.FinishedAt = stats.FinishedAt.Format(time.RFC3339)
+		data.Duration = stats.FinishedAt.Sub(stats.StartedAt).Round(time.Millisecond).String()
+	}
+	return data
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package staticreg
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/seqeralabs/staticreg/pkg/observability/logger"
+	"github.com/seqeralabs/staticreg/pkg/registry/async"
+	"github.com/seqeralabs/staticreg/pkg/registry/notifications"
+)
+
+// RegistryWebhookHandler receives the notifications of distribution compatible registries.
+// Pushed tags are synchronized right away and deleted ones are forgotten, the pages
+// showing them are removed from the cache.
+func (s *StaticregServer) RegistryWebhookHandler(c *gin.Context) {
+	log := logger.FromContext(c)
+
+	envelope, err := notifications.Parse(c.Request.Body)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	accepted := 0
+	for _, event := range envelope.Events {
+		evLog := log.With(
+			slog.String("event-id", event.ID),
+			slog.String("action", event.Action),
+			slog.String("repo", event.Target.Repository),
+			slog.String("tag", event.Target.Tag),
+			slog.String("digest", event.Target.Digest),
+		)
+
+		reg, ok := s.eventRegistry(c, event)
+		if !ok {
+			evLog.Warn("ignoring registry notification for unknown registry", slog.String("host", event.Request.Host))
+			continue
+		}
+
+		repo := event.Target.Repository
+		paths := s.repositoryPaths(reg, repo)
+
+		switch {
+		case event.Action == notifications.ActionPush && event.Target.Tag != "":
+			err := reg.Crawler.Refresh(c, repo, event.Target.Tag, func() {
+				s.invalidate(paths)
+			})
+			if errors.Is(err, async.ErrRepositoryExcluded) {
+				evLog.Debug("ignoring notification about excluded repository")
+				continue
+			}
+			if err != nil {
+				evLog.Warn("could not schedule synchronization", logger.ErrAttr(err))
+				continue
+			}
+		case event.IsRepositoryDelete():
+			reg.Crawler.DeleteRepository(repo)
+			s.invalidate(paths)
+		case event.Action == notifications.ActionDelete && event.Target.Tag != "":
+			reg.Crawler.DeleteTag(repo, event.Target.Tag)
+			s.invalidate(paths)
+		case event.IsDigestDelete():
+			tags := reg.Crawler.DeleteDigest(repo, event.Target.Digest)
+			if len(tags) == 0 {
+				// a blob, or a manifest no tag points to
+				continue
+			}
+			evLog.Debug("deleted tags pointing to manifest", slog.Any("tags", tags))
+			s.invalidate(paths)
+		default:
+			// pulls, mounts, blobs and untagged manifests (index children, referrers)
+			// are left to the periodic synchronization
+			continue
+		}
+
+		evLog.Info("registry notification handled", slog.String("registry", reg.Name))
+		accepted++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accepted": accepted})
+}
+
+// eventRegistry returns the registry an event is about: the one named by the registry
+// query parameter, the one with the hostname of the event or the only one there is
+func (s *StaticregServer) eventRegistry(c *gin.Context, event notifications.Event) (*Registry, bool) {
+	if name := c.Query("registry"); name != "" {
+		reg, ok := s.registries[name]
+		return reg, ok
+	}
+	for _, reg := range s.ordered {
+		if reg.Hostname == event.Request.Host {
+			return reg, true
+		}
+	}
+	if len(s.ordered) == 1 {
+		return s.ordered[0], true
+	}
+	return nil, false
+}
+
+// repositoryPaths returns the paths of the pages showing data about repo
+func (s *StaticregServer) repositoryPaths(reg *Registry, repo string) []string {
+	absoluteDir := reg.DataFiller.BaseData().AbsoluteDir
+	return []string{absoluteDir, absoluteDir + "repo/" + repo}
+}
+
+func (s *StaticregServer) invalidate(paths []string) {
+	for _, p := range paths {
+		_ = s.cache.Delete(p)
+	}
+}
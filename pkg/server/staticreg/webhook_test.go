@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Seqera
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package staticreg
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenyahui/gin-cache/persist"
+	"github.com/gin-gonic/gin"
+
+	"github.com/seqeralabs/staticreg/pkg/filler"
+)
+
+const testDigest = "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf"
+
+// fakeCrawler records the notifications forwarded by the webhook,
+// methods the webhook does not use are left to the embedded nil Crawler
+type fakeCrawler struct {
+	Crawler
+	// tags are the tags of each digest, in the library/app repository
+	tags map[string][]string
+
+	refreshed      []string
+	deletedTags    []string
+	deletedDigests []string
+	deletedRepos   []string
+}
+
+func (f *fakeCrawler) Refresh(_ context.Context, repo string, tag string, onComplete func()) error {
+	f.refreshed = append(f.refreshed, repo+":"+tag)
+	onComplete()
+	return nil
+}
+
+func (f *fakeCrawler) DeleteTag(repo string, tag string) {
+	f.deletedTags = append(f.deletedTags, repo+":"+tag)
+}
+
+func (f *fakeCrawler) DeleteDigest(repo string, digest string) []string {
+	f.deletedDigests = append(f.deletedDigests, repo+"@"+digest)
+	if repo != "library/app" {
+		return nil
+	}
+	tags := f.tags[digest]
+	delete(f.tags, digest)
+	return tags
+}
+
+func (f *fakeCrawler) DeleteRepository(repo string) {
+	f.deletedRepos = append(f.deletedRepos, repo)
+}
+
+// postNotification sends body to the webhook of a server with a single registry,
+// it returns the number of accepted events and whether the repository page was evicted from the cache
+func postNotification(t *testing.T, crawler *fakeCrawler, body string) (int, bool) {
+	t.Helper()
+	store := persist.NewMemoryStore(time.Minute)
+	if err := store.Set("/repo/library/app", "cached", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	s := New([]*Registry{{
+		Name:       "registry.example.com",
+		Hostname:   "registry.example.com",
+		DataFiller: filler.New(nil, "registry.example.com", "/", "/"),
+		Crawler:    crawler,
+	}}, "/", store, 0, 0)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("logger", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	})
+	r.POST("/hooks/registry", s.RegistryWebhookHandler)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/hooks/registry", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/vnd.docker.distribution.events.v1+json")
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Accepted int `json:"accepted"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var cached string
+	evicted := store.Get("/repo/library/app", &cached) != nil
+	return resp.Accepted, evicted
+}
+
+// manifestDeleteEnvelope is what distribution sends when a manifest is deleted by digest:
+// the target only carries the repository and the digest
+const manifestDeleteEnvelope = `{
+  "events": [
+    {
+      "id": "asdf-asdf-asdf-asdf-0",
+      "timestamp": "2024-06-11T14:44:26.402973972Z",
+      "action": "delete",
+      "target": {
+        "digest": "` + testDigest + `",
+        "repository": "library/app"
+      },
+      "request": {
+        "id": "asdfasdf",
+        "addr": "client.local",
+        "host": "registry.example.com",
+        "method": "DELETE",
+        "useragent": "curl/8.5.0"
+      },
+      "actor": {},
+      "source": {
+        "addr": "registry-0:5000",
+        "instanceID": "3e0bd0d5-0bd2-4f5b-8b2d-9dce7e6f7d2a"
+      }
+    }
+  ]
+}`
+
+func TestWebhookDeletesManifestByDigest(t *testing.T) {
+	crawler := &fakeCrawler{tags: map[string][]string{testDigest: {"1.0", "latest"}}}
+	accepted, evicted := postNotification(t, crawler, manifestDeleteEnvelope)
+
+	if want := []string{"library/app@" + testDigest}; !slices.Equal(crawler.deletedDigests, want) {
+		t.Fatalf("deleted digests %v, want %v", crawler.deletedDigests, want)
+	}
+	if accepted != 1 || !evicted {
+		t.Errorf("got %d accepted events and evicted=%t, want the deletion to be accepted and the page evicted", accepted, evicted)
+	}
+	if len(crawler.deletedTags) != 0 || len(crawler.deletedRepos) != 0 {
+		t.Errorf("deleted tags %v and repositories %v, want nothing else deleted", crawler.deletedTags, crawler.deletedRepos)
+	}
+}
+
+func TestWebhookIgnoresBlobDelete(t *testing.T) {
+	// blob deletions carry a digest no tag points to
+	crawler := &fakeCrawler{tags: map[string][]string{}}
+	accepted, evicted := postNotification(t, crawler, manifestDeleteEnvelope)
+
+	if len(crawler.deletedDigests) != 1 {
+		t.Fatalf("deleted digests %v, want the digest to be looked up", crawler.deletedDigests)
+	}
+	if accepted != 0 || evicted {
+		t.Errorf("got %d accepted events and evicted=%t, want nothing to happen", accepted, evicted)
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	envelope := `{"events": [
+		{"id": "1", "action": "push", "target": {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "` + testDigest + `", "repository": "library/app", "tag": "2.0"}, "request": {"host": "registry.example.com"}},
+		{"id": "2", "action": "push", "target": {"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": "` + testDigest + `", "repository": "library/app"}, "request": {"host": "registry.example.com"}},
+		{"id": "3", "action": "pull", "target": {"digest": "` + testDigest + `", "repository": "library/app", "tag": "2.0"}, "request": {"host": "registry.example.com"}},
+		{"id": "4", "action": "delete", "target": {"repository": "library/app", "tag": "1.0"}, "request": {"host": "registry.example.com"}},
+		{"id": "5", "action": "delete", "target": {"repository": "library/old"}, "request": {"host": "registry.example.com"}}
+	]}`
+	crawler := &fakeCrawler{}
+	accepted, _ := postNotification(t, crawler, envelope)
+
+	if want := []string{"library/app:2.0"}; !slices.Equal(crawler.refreshed, want) {
+		t.Errorf("refreshed %v, want %v", crawler.refreshed, want)
+	}
+	if want := []string{"library/app:1.0"}; !slices.Equal(crawler.deletedTags, want) {
+		t.Errorf("deleted tags %v, want %v", crawler.deletedTags, want)
+	}
+	if want := []string{"library/old"}; !slices.Equal(crawler.deletedRepos, want) {
+		t.Errorf("deleted repositories %v, want %v", crawler.deletedRepos, want)
+	}
+	if len(crawler.deletedDigests) != 0 {
+		t.Errorf("deleted digests %v, want none", crawler.deletedDigests)
+	}
+	if accepted != 3 {
+		t.Errorf("got %d accepted events, want 3", accepted)
+	}
+}
@@ -30,6 +30,9 @@ var htmlTemplates map[string]*template.Template
 func init() {
 	templateDefs := map[string]string{
 		"index":      "index.html",
+		"registries": "registries.html",
+		"status":     "status.html",
+		"indexing":   "indexing.html",
 		"repository": "repository.html",
 		"404":        "404.html",
 		"500":        "500.html",
@@ -45,6 +48,9 @@ func init() {
 }
 
 type BaseData struct {
+	// RootDir is where the site is served from, static assets live under it
+	RootDir string
+	// AbsoluteDir is where the pages of the current registry are served from
 	AbsoluteDir  string
 	RegistryName string
 	LastUpdated  string
@@ -60,25 +66,203 @@ func RenderIndex(w io.Writer, data IndexData) error {
 	return tpl.Execute(w, data)
 }
 
+type RegistriesData struct {
+	BaseData
+	Registries []RegistryData
+}
+
+type RegistryData struct {
+	Name         string
+	Hostname     string
+	AbsoluteDir  string
+	Status       string
+	Error        string
+	LastSyncedAt string
+}
+
+func RenderRegistries(w io.Writer, data RegistriesData) error {
+	tpl := htmlTemplates["registries"]
+	return tpl.Execute(w, data)
+}
+
+type StatusData struct {
+	BaseData
+	Registries []RegistryStatusData
+}
+
+type RegistryStatusData struct {
+	Name        string
+	Hostname    string
+	AbsoluteDir string
+	// Phase is idle, catalog or tags
+	Phase     string
+	LastError string
+	// Current is the synchronization in progress, LastSync the last completed one
+	Current  *SyncStatsData
+	LastSync *SyncStatsData
+	Errors   []ItemErrorData
+	// Retries are waiting to be tried again, DeadLetters are not retried until the next synchronization
+	Retries     []RetryData
+	DeadLetters []DeadLetterData
+}
+
+type SyncStatsData struct {
+	Generation           uint64
+	StartedAt            string
+	FinishedAt           string
+	Duration             string
+	Repositories         int64
+	RepositoriesFailed   int64
+	RepositoriesExcluded int64
+	TagsUnchanged        int64
+	TagsUpdated          int64
+	TagsNew              int64
+	TagsFailed           int64
+	TagsUntracked        int64
+	RepositoriesEvicted  int64
+	TagsEvicted          int64
+}
+
+type ItemErrorData struct {
+	Repository string
+	Tag        string
+	Error      string
+	At         string
+}
+
+type RetryData struct {
+	Repository string
+	Tag        string
+	Attempts   int
+	Error      string
+	NextAt     string
+}
+
+type DeadLetterData struct {
+	Repository string
+	Tag        string
+	Attempts   int
+	// Permanent is set when the error cannot be fixed by retrying
+	Permanent bool
+	Error     string
+	At        string
+}
+
+func RenderStatus(w io.Writer, data StatusData) error {
+	tpl := htmlTemplates["status"]
+	return tpl.Execute(w, data)
+}
+
 type TagData struct {
 	Name          string
 	Tag           string
 	PullReference string
+	PullCommand   string
 	CreatedAt     string
+	// Index is true when the tag points to a multi-platform image index
+	Index     bool
+	Platforms []PlatformData
+	// Config is the platform whose configuration is shown, linux/amd64 when available
+	Config *PlatformData
+	// Referrers are the artifacts attached to the tag, grouped by artifact type
+	Referrers []ReferrerGroup
+	// Artifact is set when the tag points to a non-container artifact
+	Artifact *ArtifactData
+	// Untracked is set for tags left out by the tag policy, only their name is known
+	Untracked bool
+}
+
+type ArtifactData struct {
+	// Kind is one of helm, sif, wasm or generic
+	Kind  string
+	Type  string
+	Files []ArtifactFileData
+	Helm  *HelmData
+	SIF   *SIFData
+	WASM  *WASMData
+}
+
+type ArtifactFileData struct {
+	Name        string
+	MediaType   string
+	Digest      string
+	ShortDigest string
+	Size        string
+}
+
+type HelmData struct {
+	Name        string
+	Version     string
+	AppVersion  string
+	Description string
+	Home        string
+}
+
+type SIFData struct {
+	Version    string
+	Arch       string
+	ID         string
+	CreatedAt  string
+	ModifiedAt string
+}
+
+type WASMData struct {
+	Platform string
+	Author   string
+}
+
+type ReferrerGroup struct {
+	// Kind is a human friendly name for ArtifactType, like Signature or SBOM
+	Kind         string
+	ArtifactType string
+	Referrers    []ReferrerData
+}
+
+type ReferrerData struct {
+	Digest      string
+	ShortDigest string
+	Size        string
+	// Tag is set when the referrer was found through a fallback tag
+	Tag       string
+	CreatedAt string
+}
+
+type PlatformData struct {
+	Platform     string
+	Digest       string
+	ShortDigest  string
+	MediaType    string
+	Size         string
+	Layers       int
+	CreatedAt    string
+	Entrypoint   string
+	Cmd          string
+	ExposedPorts []string
+	Labels       []KeyValueData
+	Annotations  []KeyValueData
+}
+
+type KeyValueData struct {
+	Key   string
+	Value string
 }
 
 type RepositoryData struct {
 	BaseData
 	RepositoryName string
 	PullReference  string
+	PullCommand    string
 	Tags           []TagData
 	LastUpdatedAt  string
+	// Platforms are all the platforms available across tags, used to filter them
+	Platforms []string
 }
 
 type IndexRepositoryData struct {
 	BaseData
 	RepositoryName string
 	PullReference  string
+	PullCommand    string
 	LastUpdatedAt  string
 }
 
@@ -87,6 +271,18 @@ func RenderRepository(w io.Writer, data RepositoryData) error {
 	return tpl.Execute(w, data)
 }
 
+type IndexingData struct {
+	BaseData
+	RepositoryName string
+	// RefreshSeconds is how long to wait before reloading the page
+	RefreshSeconds int
+}
+
+func RenderIndexing(w io.Writer, data IndexingData) error {
+	tpl := htmlTemplates["indexing"]
+	return tpl.Execute(w, data)
+}
+
 func Render404(w io.Writer, data BaseData) error {
 	tpl := htmlTemplates["404"]
 	return tpl.Execute(w, data)